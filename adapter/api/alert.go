@@ -0,0 +1,18 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+func (s *Server) registerAlertHandlers() {
+	s.mux.HandleFunc("POST /api/alerts/{id}/ack", s.alertAck)
+}
+
+func (s *Server) alertAck(w http.ResponseWriter, r *http.Request) {
+	if !s.alert.Ack(r.PathValue("id")) {
+		s.error(w, http.StatusNotFound, errors.New("alert not found"))
+		return
+	}
+	s.response(w, http.StatusOK, &countResponse{Count: 1})
+}
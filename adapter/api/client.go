@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// Client calls the API of the running application, it is used by the command line interface
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func NewClient(cfg *Config) *Client {
+	cfg.normalize()
+
+	return &Client{
+		baseURL: "http://" + clientAddress(cfg.Listen),
+		token:   cfg.Token,
+		http:    &http.Client{Timeout: cfg.Timeout + responseMargin},
+	}
+}
+
+// Do sends the request with the JSON body and decodes the response into out, errors returned by the API
+// are converted to Go errors
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &errorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || len(e.Error) == 0 {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return errors.New(e.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Health returns the result of the liveness or the readiness check
+func (c *Client) Health(ctx context.Context, path string) (*entity.Health, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	h := &entity.Health{}
+	if err := json.NewDecoder(resp.Body).Decode(h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(c.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return c.http.Do(req)
+}
+
+// clientAddress replaces the unspecified host of the listen address with the loopback address
+func clientAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if ip := net.ParseIP(host); len(host) == 0 || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,25 @@
+package api
+
+import "time"
+
+const (
+	defaultListen  = "127.0.0.1:8080"
+	defaultTimeout = 10 * time.Second
+)
+
+type Config struct {
+	Listen  string
+	Timeout time.Duration
+	Token   string // bearer token required by all requests if set
+	// HealthOnly serves only the health checks, it is used when the API is disabled in the configuration file
+	HealthOnly bool
+}
+
+func (c *Config) normalize() {
+	if len(c.Listen) == 0 {
+		c.Listen = defaultListen
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/forest33/honeybee/adapter/script"
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/structs"
+)
+
+type ScriptHandler interface {
+	Scripts() []*entity.ScriptInfo
+	Timers() []*entity.TimerInfo
+	Globals() map[string]string
+	EnableScript(name string) error
+	DisableScript(name string) error
+	ReloadScript(name string) error
+	CallFunction(ctx context.Context, name, fn string, args []byte) ([]byte, error)
+	InjectMessage(ctx context.Context, name, topic string, payload []byte, retained bool) error
+}
+
+// CallRequest is the body of POST /api/scripts/{name}/call
+type CallRequest struct {
+	Function string          `json:"function"`
+	Args     json.RawMessage `json:"args,omitempty"`
+}
+
+// CallResponse contains the values returned by the function
+type CallResponse struct {
+	Result json.RawMessage `json:"result"`
+}
+
+// InjectRequest is the body of POST /api/scripts/{name}/inject, the payload is a string or a JSON value
+type InjectRequest struct {
+	Topic    string          `json:"topic"`
+	Payload  json.RawMessage `json:"payload"`
+	Retained bool            `json:"retained"`
+}
+
+type Runtime interface {
+	Status() *entity.Status
+	Subscriptions() *entity.Subscriptions
+	Liveness() *entity.Health
+	Readiness() *entity.Health
+}
+
+func (s *Server) registerScriptHandlers() {
+	s.mux.HandleFunc("GET /api/scripts", s.scripts)
+	s.mux.HandleFunc("GET /api/timers", s.timers)
+	s.mux.HandleFunc("GET /api/globals", s.globals)
+	s.mux.HandleFunc("POST /api/scripts/{name}/enable", s.scriptControl(s.sh.EnableScript))
+	s.mux.HandleFunc("POST /api/scripts/{name}/disable", s.scriptControl(s.sh.DisableScript))
+	s.mux.HandleFunc("POST /api/scripts/{name}/reload", s.scriptControl(s.sh.ReloadScript))
+	s.mux.HandleFunc("POST /api/scripts/{name}/call", s.scriptCall)
+	s.mux.HandleFunc("POST /api/scripts/{name}/inject", s.scriptInject)
+}
+
+func (s *Server) registerRuntimeHandlers() {
+	s.mux.HandleFunc("GET /api/status", s.status)
+	s.mux.HandleFunc("GET /api/subscriptions", s.subscriptions)
+}
+
+func (s *Server) registerHealthHandlers() {
+	s.mux.HandleFunc("GET "+HealthPath, s.health(s.runtime.Liveness))
+	s.mux.HandleFunc("GET "+ReadyPath, s.health(s.runtime.Readiness))
+}
+
+func (s *Server) scripts(w http.ResponseWriter, _ *http.Request) {
+	s.response(w, http.StatusOK, s.sh.Scripts())
+}
+
+func (s *Server) timers(w http.ResponseWriter, _ *http.Request) {
+	s.response(w, http.StatusOK, s.sh.Timers())
+}
+
+func (s *Server) globals(w http.ResponseWriter, _ *http.Request) {
+	s.response(w, http.StatusOK, s.sh.Globals())
+}
+
+func (s *Server) scriptControl(f func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := f(r.PathValue("name")); err != nil {
+			s.error(w, scriptErrorStatus(err), err)
+			return
+		}
+		s.response(w, http.StatusOK, &countResponse{Count: 1})
+	}
+}
+
+func (s *Server) scriptCall(w http.ResponseWriter, r *http.Request) {
+	req := &CallRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Function) == 0 {
+		s.error(w, http.StatusBadRequest, errors.New("function is not specified"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Timeout)
+	defer cancel()
+
+	result, err := s.sh.CallFunction(ctx, r.PathValue("name"), req.Function, req.Args)
+	if err != nil {
+		s.scriptError(ctx, w, err)
+		return
+	}
+
+	s.response(w, http.StatusOK, &CallResponse{Result: result})
+}
+
+func (s *Server) scriptInject(w http.ResponseWriter, r *http.Request) {
+	req := &InjectRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Topic) == 0 {
+		s.error(w, http.StatusBadRequest, errors.New("topic is not specified"))
+		return
+	}
+
+	// the string payload is passed as is, other JSON values are passed encoded
+	payload := []byte(req.Payload)
+	var str string
+	if err := json.Unmarshal(req.Payload, &str); err == nil {
+		payload = []byte(str)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Timeout)
+	defer cancel()
+
+	if err := s.sh.InjectMessage(ctx, r.PathValue("name"), req.Topic, payload, req.Retained); err != nil {
+		s.scriptError(ctx, w, err)
+		return
+	}
+
+	s.response(w, http.StatusOK, &countResponse{Count: 1})
+}
+
+// scriptError responds with 504 Gateway Timeout if the script didn't finish in time, the script isn't interrupted
+func (s *Server) scriptError(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+		s.error(w, http.StatusGatewayTimeout, fmt.Errorf("the script didn't finish within %s, it keeps running", s.cfg.Timeout))
+		return
+	}
+	s.error(w, scriptErrorStatus(err), err)
+}
+
+// scriptErrorStatus returns the HTTP status of the script control error, other errors are raised by the script
+func scriptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, script.ErrScriptNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, script.ErrScriptDisabled), errors.Is(err, script.ErrScriptEnabled),
+		errors.Is(err, script.ErrScriptNotLoaded), errors.Is(err, script.ErrScriptUnloaded):
+		return http.StatusConflict
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func (s *Server) status(w http.ResponseWriter, _ *http.Request) {
+	s.response(w, http.StatusOK, s.runtime.Status())
+}
+
+func (s *Server) subscriptions(w http.ResponseWriter, _ *http.Request) {
+	s.response(w, http.StatusOK, s.runtime.Subscriptions())
+}
+
+// health responds with 503 Service Unavailable if the check failed
+func (s *Server) health(check func() *entity.Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		h := check()
+		s.response(w, structs.If(h.OK, http.StatusOK, http.StatusServiceUnavailable), h)
+	}
+}
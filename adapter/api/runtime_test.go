@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forest33/honeybee/adapter/script"
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+// fakeScripts runs the call and the injection with the function of the test case
+type fakeScripts struct {
+	run func(ctx context.Context) error
+}
+
+func (f *fakeScripts) Scripts() []*entity.ScriptInfo { return nil }
+func (f *fakeScripts) Timers() []*entity.TimerInfo   { return nil }
+func (f *fakeScripts) Globals() map[string]string    { return nil }
+func (f *fakeScripts) EnableScript(string) error     { return nil }
+func (f *fakeScripts) DisableScript(string) error    { return nil }
+func (f *fakeScripts) ReloadScript(string) error     { return nil }
+
+func (f *fakeScripts) CallFunction(ctx context.Context, _, _ string, _ []byte) ([]byte, error) {
+	if err := f.run(ctx); err != nil {
+		return nil, err
+	}
+	return []byte(`[5]`), nil
+}
+
+func (f *fakeScripts) InjectMessage(ctx context.Context, _, _ string, _ []byte, _ bool) error {
+	return f.run(ctx)
+}
+
+func TestScriptTimeout(t *testing.T) {
+	// wait is the script which doesn't finish until the request is cancelled
+	wait := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		run    func(ctx context.Context) error
+		status int
+		error  string
+	}{
+		{
+			name:   "call",
+			path:   "/api/scripts/heating/call",
+			body:   `{"function": "Get"}`,
+			run:    func(context.Context) error { return nil },
+			status: http.StatusOK,
+		},
+		{
+			name:   "slow call",
+			path:   "/api/scripts/heating/call",
+			body:   `{"function": "Get"}`,
+			run:    wait,
+			status: http.StatusGatewayTimeout,
+			error:  "the script didn't finish within 200ms, it keeps running",
+		},
+		{
+			name:   "slow inject",
+			path:   "/api/scripts/heating/inject",
+			body:   `{"topic": "thermostat", "payload": 18}`,
+			run:    wait,
+			status: http.StatusGatewayTimeout,
+			error:  "the script didn't finish within 200ms, it keeps running",
+		},
+		{
+			name:   "script not found",
+			path:   "/api/scripts/heating/call",
+			body:   `{"function": "Get"}`,
+			run:    func(context.Context) error { return script.ErrScriptNotFound },
+			status: http.StatusNotFound,
+			error:  script.ErrScriptNotFound.Error(),
+		},
+		{
+			// the deadline of the script itself is the script error
+			name:   "script error",
+			path:   "/api/scripts/heating/call",
+			body:   `{"function": "Get"}`,
+			run:    func(context.Context) error { return fmt.Errorf("request failed: %w", context.DeadlineExceeded) },
+			status: http.StatusUnprocessableEntity,
+			error:  "request failed: context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(context.Background(), &Config{Timeout: 200 * time.Millisecond}, logger.NewDefault())
+			s.SetScriptHandler(&fakeScripts{run: tt.run})
+			s.registerScriptHandlers()
+
+			srv := httptest.NewServer(s.srv.Handler)
+			defer srv.Close()
+
+			resp, err := http.Post(srv.URL+tt.path, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+			if len(tt.error) == 0 {
+				return
+			}
+
+			e := &errorResponse{}
+			if err := json.NewDecoder(resp.Body).Decode(e); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if e.Error != tt.error {
+				t.Errorf("expected error %q, got %q", tt.error, e.Error)
+			}
+		})
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	s := New(context.Background(), &Config{Timeout: 10 * time.Second}, logger.NewDefault())
+	if s.srv.WriteTimeout <= s.cfg.Timeout {
+		t.Errorf("expected the write timeout %s to exceed the handler timeout %s", s.srv.WriteTimeout, s.cfg.Timeout)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/forest33/honeybee/pkg/scheduler"
+)
+
+type Scheduler interface {
+	Tasks() map[string][]*scheduler.TaskInfo
+	DeadLetters() []*scheduler.DeadLetter
+	Cancel(id int64) bool
+	CancelSender(sender string) int
+	Flush(id int64) bool
+	FlushSender(sender string) int
+}
+
+type countResponse struct {
+	Count int `json:"count"`
+}
+
+func (s *Server) registerSchedulerHandlers() {
+	s.mux.HandleFunc("GET /api/scheduler/tasks", s.schedulerTasks)
+	s.mux.HandleFunc("GET /api/scheduler/deadletters", s.schedulerDeadLetters)
+	s.mux.HandleFunc("DELETE /api/scheduler/tasks", s.schedulerCancelSender)
+	s.mux.HandleFunc("DELETE /api/scheduler/tasks/{id}", s.schedulerCancel)
+	s.mux.HandleFunc("POST /api/scheduler/flush", s.schedulerFlushSender)
+	s.mux.HandleFunc("POST /api/scheduler/tasks/{id}/flush", s.schedulerFlush)
+}
+
+func (s *Server) schedulerTasks(w http.ResponseWriter, r *http.Request) {
+	tasks := s.sched.Tasks()
+	if sender := r.URL.Query().Get("sender"); len(sender) != 0 {
+		s.response(w, http.StatusOK, map[string][]*scheduler.TaskInfo{sender: tasks[sender]})
+		return
+	}
+	s.response(w, http.StatusOK, tasks)
+}
+
+func (s *Server) schedulerDeadLetters(w http.ResponseWriter, _ *http.Request) {
+	s.response(w, http.StatusOK, s.sched.DeadLetters())
+}
+
+func (s *Server) schedulerCancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.sched.Cancel(id) {
+		s.error(w, http.StatusNotFound, errors.New("task not found or already running"))
+		return
+	}
+	s.response(w, http.StatusOK, &countResponse{Count: 1})
+}
+
+func (s *Server) schedulerCancelSender(w http.ResponseWriter, r *http.Request) {
+	sender := r.URL.Query().Get("sender")
+	if len(sender) == 0 {
+		s.error(w, http.StatusBadRequest, errors.New("sender is not specified"))
+		return
+	}
+	s.response(w, http.StatusOK, &countResponse{Count: s.sched.CancelSender(sender)})
+}
+
+func (s *Server) schedulerFlush(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.sched.Flush(id) {
+		s.error(w, http.StatusNotFound, errors.New("task not found or already running"))
+		return
+	}
+	s.response(w, http.StatusOK, &countResponse{Count: 1})
+}
+
+func (s *Server) schedulerFlushSender(w http.ResponseWriter, r *http.Request) {
+	s.response(w, http.StatusOK, &countResponse{Count: s.sched.FlushSender(r.URL.Query().Get("sender"))})
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/metrics"
+)
+
+const (
+	HealthPath = "/healthz"
+	ReadyPath  = "/readyz"
+
+	// responseMargin is added to the write timeout, so that handlers which wait for scripts up to the Timeout
+	// have time to write the response
+	responseMargin = time.Second
+)
+
+// Server is a local HTTP server exposing the runtime state as JSON
+type Server struct {
+	ctx     context.Context
+	cfg     *Config
+	log     *logger.Logger
+	srv     *http.Server
+	mux     *http.ServeMux
+	sched   Scheduler
+	alert   entity.AlertHandler
+	sh      ScriptHandler
+	runtime Runtime
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func New(ctx context.Context, cfg *Config, log *logger.Logger) *Server {
+	cfg.normalize()
+
+	s := &Server{
+		ctx: ctx,
+		cfg: cfg,
+		log: log,
+		mux: http.NewServeMux(),
+	}
+
+	s.srv = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           s.auth(s.mux),
+		ReadHeaderTimeout: cfg.Timeout,
+		WriteTimeout:      cfg.Timeout + responseMargin,
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	return s
+}
+
+func (s *Server) SetScheduler(sched Scheduler) {
+	s.sched = sched
+}
+
+func (s *Server) SetAlertHandler(alert entity.AlertHandler) {
+	s.alert = alert
+}
+
+func (s *Server) SetScriptHandler(sh ScriptHandler) {
+	s.sh = sh
+}
+
+func (s *Server) SetRuntime(runtime Runtime) {
+	s.runtime = runtime
+}
+
+// Start registers the handlers of available components and starts listening
+func (s *Server) Start() error {
+	if s.sched != nil {
+		s.registerSchedulerHandlers()
+	}
+	if s.alert != nil {
+		s.registerAlertHandlers()
+	}
+	if s.sh != nil {
+		s.registerScriptHandlers()
+	}
+	if s.runtime != nil {
+		s.registerHealthHandlers()
+	}
+	if s.runtime != nil && !s.cfg.HealthOnly {
+		s.registerRuntimeHandlers()
+	}
+	if !s.cfg.HealthOnly {
+		s.mux.Handle("GET /metrics", metrics.Handler())
+	}
+
+	ln, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error().Err(err).Msg("API server error")
+		}
+	}()
+
+	entity.GetWg(s.ctx).Add(1)
+	go func() {
+		<-s.ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+		defer cancel()
+		if err := s.srv.Shutdown(ctx); err != nil {
+			s.log.Error().Err(err).Msg("failed to stop API server")
+		}
+		s.log.Info().Msg("API server stopped")
+		entity.GetWg(s.ctx).Done()
+	}()
+
+	s.log.Info().Str("listen", s.cfg.Listen).Bool("health_only", s.cfg.HealthOnly).Msg("API server started")
+
+	return nil
+}
+
+// auth checks the bearer token if it is configured, health checks are public for container runtimes and monitoring
+func (s *Server) auth(next http.Handler) http.Handler {
+	if len(s.cfg.Token) == 0 {
+		return next
+	}
+
+	expected := []byte("Bearer " + s.cfg.Token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == HealthPath || r.URL.Path == ReadyPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			s.log.Warn().Str("remote", r.RemoteAddr).Str("path", r.URL.Path).Msg("unauthorized API request")
+			s.error(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) response(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.log.Error().Err(err).Msg("failed to write API response")
+	}
+}
+
+func (s *Server) error(w http.ResponseWriter, status int, err error) {
+	s.response(w, status, &errorResponse{Error: err.Error()})
+}
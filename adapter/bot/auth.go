@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// reportInterval limits reports about the same unauthorized user
+const reportInterval = 10 * time.Minute
+
+// initRoles maps the configured users to their roles. Bot.Admins is a deprecated alias of the users with the admin
+// role, the role of the user listed in Bot.Users is kept.
+func (b *Bot) initRoles() error {
+	for _, u := range b.cfg.Users {
+		r, err := entity.ParseBotRole(u.Role)
+		if err != nil {
+			return fmt.Errorf("user %d: %w", u.Id, err)
+		}
+		b.roles[u.Id] = r
+	}
+
+	if len(b.cfg.Admins) != 0 {
+		b.log.Warn().Ints64("admins", b.cfg.Admins).Msg("Bot.Admins is deprecated, list the users in Bot.Users with the admin role")
+	}
+	for _, id := range b.cfg.Admins {
+		if _, ok := b.roles[id]; !ok {
+			b.roles[id] = entity.BotRoleAdmin
+		}
+	}
+
+	return nil
+}
+
+// role returns the role of the user in the chat. Without the Users list the members of the configured chats
+// are users, admins are granted only by Bot.Users or the deprecated Bot.Admins.
+func (b *Bot) role(chatID int64, u *tgbotapi.User) entity.BotRole {
+	if u == nil {
+		return entity.BotRoleNone
+	}
+	if r, ok := b.roles[u.ID]; ok {
+		return r
+	}
+	if len(b.cfg.Users) == 0 && slices.Contains(b.cfg.ChatId, chatID) {
+		return entity.BotRoleUser
+	}
+	return entity.BotRoleNone
+}
+
+// unauthorized logs the update of the unauthorized user and reports it to the admins
+func (b *Bot) unauthorized(chatID int64, u *tgbotapi.User, text, reason string) {
+	var userID int64
+	if u != nil {
+		userID = u.ID
+	}
+
+	b.log.Warn().
+		Int64("chat_id", chatID).
+		Int64("user_id", userID).
+		Str("user", userName(u)).
+		Str("text", text).
+		Msg(reason)
+
+	if !b.cfg.ReportUnauthorized {
+		return
+	}
+
+	admins := make([]int64, 0, len(b.roles))
+	for id, r := range b.roles {
+		if r == entity.BotRoleAdmin {
+			admins = append(admins, id)
+		}
+	}
+	if len(admins) == 0 {
+		return
+	}
+
+	b.SendMessage(&entity.BotMessage{
+		Chats:          admins,
+		Text:           fmt.Sprintf("Unauthorized access\nUser: %s (%d)\nChat: %d\n%s", userName(u), userID, chatID, text),
+		ParseMode:      entity.BotParseModePlain,
+		DedupeKey:      fmt.Sprintf("unauthorized:%d", userID),
+		DedupeInterval: reportInterval,
+	})
+}
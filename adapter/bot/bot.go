@@ -2,12 +2,19 @@ package bot
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+	"github.com/forest33/honeybee/business/entity"
 	"github.com/forest33/honeybee/pkg/logger"
 	"github.com/forest33/honeybee/pkg/scheduler"
+	"github.com/forest33/honeybee/pkg/structs"
 )
 
 type Bot struct {
@@ -15,22 +22,50 @@ type Bot struct {
 	cfg      *Config
 	log      *logger.Logger
 	sh       Scheduler
+	limiter  Limiter
 	bot      *tgbotapi.BotAPI
 	updates  tgbotapi.UpdatesChannel
-	workerCh chan string
+	workerCh chan *entity.BotMessage
+	groups   map[string][]int64
+	roles    map[int64]entity.BotRole
+	throttle *throttle
+	live     *liveMessages
+
+	commandHandler  atomic.Pointer[func(c *entity.BotCommand)]
+	callbackHandler atomic.Pointer[func(c *entity.BotCallback)]
+	readOnce        sync.Once
 }
 
+const (
+	taskSender      = "telegram"
+	taskKindMessage = "telegram.message"
+	limiterChannel  = "telegram"
+	captionLimit    = 1024
+	photoSizeLimit  = 10 << 20
+)
+
+var photoExt = map[string]struct{}{".jpg": {}, ".jpeg": {}, ".png": {}, ".gif": {}, ".webp": {}}
+
 type Scheduler interface {
 	AddTask(t *scheduler.Task)
+	RegisterHandler(kind string, h scheduler.TaskHandler)
 }
 
-func New(ctx context.Context, cfg *Config, log *logger.Logger, sh Scheduler) (*Bot, error) {
+type Limiter interface {
+	Allow(channel, key string, interval time.Duration) (bool, int)
+}
+
+func New(ctx context.Context, cfg *Config, log *logger.Logger, sh Scheduler, limiter Limiter) (*Bot, error) {
 	b := &Bot{
 		ctx:      ctx,
 		cfg:      cfg,
 		log:      log,
 		sh:       sh,
-		workerCh: make(chan string, cfg.PoolSize),
+		limiter:  limiter,
+		workerCh: make(chan *entity.BotMessage, cfg.PoolSize),
+		groups:   make(map[string][]int64, len(cfg.Groups)),
+		roles:    make(map[int64]entity.BotRole, len(cfg.Users)+len(cfg.Admins)),
+		throttle: newThrottle(),
 	}
 
 	if err := b.init(); err != nil {
@@ -43,7 +78,22 @@ func New(ctx context.Context, cfg *Config, log *logger.Logger, sh Scheduler) (*B
 func (b *Bot) init() error {
 	var err error
 
-	b.bot, err = tgbotapi.NewBotAPI(b.cfg.Token)
+	if b.live, err = newLiveMessages(b.cfg.LiveMessagesFile); err != nil {
+		return err
+	}
+
+	for _, g := range b.cfg.Groups {
+		if _, ok := b.groups[g.Name]; ok {
+			return fmt.Errorf("duplicate recipient group %s", g.Name)
+		}
+		b.groups[g.Name] = g.ChatId
+	}
+
+	if err := b.initRoles(); err != nil {
+		return err
+	}
+
+	b.bot, err = tgbotapi.NewBotAPIWithAPIEndpoint(b.cfg.Token, structs.If(len(b.cfg.APIEndpoint) != 0, b.cfg.APIEndpoint, tgbotapi.APIEndpoint))
 	if err != nil {
 		return err
 	}
@@ -53,6 +103,23 @@ func (b *Bot) init() error {
 
 	b.updates = b.bot.GetUpdatesChan(u)
 
+	if b.sh != nil {
+		b.sh.RegisterHandler(taskKindMessage, func(payload []byte) error {
+			m := &entity.BotMessage{}
+			if err := json.Unmarshal(payload, m); err != nil {
+				// tasks stored by the previous versions contain the text only
+				m.Text = string(payload)
+			}
+			sent, err := b.sendMessage(m)
+			if err != nil && len(sent) != 0 {
+				// the new task retries the chats which the message was not sent to
+				b.retry(m, err)
+				return nil
+			}
+			return err
+		})
+	}
+
 	for range b.cfg.PoolSize {
 		go b.worker()
 	}
@@ -71,33 +138,109 @@ func (b *Bot) worker() {
 			if !ok {
 				return
 			}
-			if err := b.sendMessage(msg); err != nil {
+			if _, err := b.sendMessage(msg); err != nil {
 				b.log.Error().Err(err).Msg("failed to send message")
 				if b.sh != nil {
-					b.sh.AddTask(&scheduler.Task{Handler: func() error {
-						return b.sendMessage(msg)
-					}})
+					b.retry(msg, err)
 				}
 			}
 		}
 	}
 }
 
-func (b *Bot) SendMessage(text string) {
-	b.workerCh <- text
+// retry queues the message to the chats which it was not sent to
+func (b *Bot) retry(m *entity.BotMessage, sendErr error) {
+	msg := *m
+	var e *sendError
+	if errors.As(sendErr, &e) {
+		msg.Chats, msg.Groups = e.chats, nil
+	}
+
+	payload, err := json.Marshal(&msg)
+	if err != nil {
+		b.log.Error().Err(err).Msg("failed to encode message")
+		return
+	}
+
+	b.sh.AddTask(&scheduler.Task{
+		Sender:   taskSender,
+		Kind:     taskKindMessage,
+		Payload:  payload,
+		Volatile: msg.File != nil, // the content of the attachment is not written to the store
+	})
 }
 
-func (b *Bot) sendMessage(text string) error {
-	if b.bot == nil {
-		return errors.New("bot not initialized")
+// SendMessage queues the message, failed messages are retried by the scheduler
+func (b *Bot) SendMessage(m *entity.BotMessage) {
+	msg, err := b.prepare(m)
+	if err != nil {
+		b.log.Error().Err(err).Msg("failed to prepare message")
+		return
+	}
+	if msg != nil {
+		b.workerCh <- msg
 	}
+}
 
-	for i := range b.cfg.ChatId {
-		msg := tgbotapi.NewMessage(b.cfg.ChatId[i], text)
-		if _, err := b.bot.Send(msg); err != nil {
-			return err
-		}
+// Send sends the message and returns the sent messages, nothing is returned for the message suppressed by rate limit.
+// Failed chats are not retried, the error lists them and the messages sent to other chats are returned.
+func (b *Bot) Send(m *entity.BotMessage) ([]*entity.BotSentMessage, error) {
+	msg, err := b.prepare(m)
+	if err != nil || msg == nil {
+		return nil, err
+	}
+
+	return b.sendMessage(msg)
+}
+
+// EditMessage replaces the text and the inline keyboard of the sent message
+func (b *Bot) EditMessage(chatID int64, messageID int, m *entity.BotMessage) error {
+	msg := tgbotapi.NewEditMessageText(chatID, messageID, m.Text)
+	msg.ParseMode = b.parseMode(m)
+	msg.ReplyMarkup = keyboard(m.Keyboard)
+
+	_, err := b.request(chatID, msg)
+
+	return err
+}
+
+func (b *Bot) DeleteMessage(chatID int64, messageID int) error {
+	_, err := b.call(chatID, tgbotapi.NewDeleteMessage(chatID, messageID))
+	return err
+}
+
+// prepare applies the rate limit and loads the attachment, nil is returned if the message must not be sent
+func (b *Bot) prepare(m *entity.BotMessage) (*entity.BotMessage, error) {
+	if err := b.checkGroups(m); err != nil {
+		return nil, err
+	}
+
+	// the attachment is loaded first, so the message which can't be sent doesn't use the token of the limiter
+	file, err := m.File.Load(b.cfg.MaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, suppressed := b.limiter.Allow(limiterChannel, m.DedupeKey, m.DedupeInterval)
+	if !ok {
+		b.log.Debug().Str("key", m.DedupeKey).Msg("message suppressed by rate limit")
+		return nil, nil
 	}
 
+	msg := *m
+	msg.File = file
+	if suppressed > 0 {
+		msg.Text += fmt.Sprintf("\n\n(%d similar messages suppressed)", suppressed)
+	}
+
+	return &msg, nil
+}
+
+func (b *Bot) checkGroups(m *entity.BotMessage) error {
+	for _, g := range m.Groups {
+		if _, ok := b.groups[g]; !ok {
+			return fmt.Errorf("unknown recipient group %s", g)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,615 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/ratelimit"
+	"github.com/forest33/honeybee/pkg/scheduler"
+)
+
+const testToken = "123:test"
+
+// apiRequest is the request received by the fake Bot API server
+type apiRequest struct {
+	method string
+	fields url.Values
+	file   string // name of the uploaded file
+	at     time.Time
+}
+
+// fakeAPI is the Bot API server which records the requests, requests to the failing chats are rejected,
+// requests to the blocked chats wait until the channel is closed
+type fakeAPI struct {
+	srv        *httptest.Server
+	requests   []*apiRequest
+	failing    map[string]bool
+	retryAfter map[string]int
+	blocked    map[string]chan struct{}
+	messageID  int
+	sync.Mutex
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	api := &fakeAPI{
+		failing:    make(map[string]bool),
+		retryAfter: make(map[string]int),
+		blocked:    make(map[string]chan struct{}),
+	}
+	api.srv = httptest.NewServer(http.HandlerFunc(api.handle))
+	t.Cleanup(api.srv.Close)
+	return api
+}
+
+func (api *fakeAPI) handle(w http.ResponseWriter, r *http.Request) {
+	method := path.Base(r.URL.Path)
+	if r.URL.Path != "/bot"+testToken+"/"+method {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch method {
+	case "getMe":
+		reply(w, map[string]any{"id": 1, "is_bot": true, "username": "test_bot"})
+		return
+	case "getUpdates":
+		select {
+		case <-r.Context().Done():
+		case <-time.After(50 * time.Millisecond):
+		}
+		reply(w, []any{})
+		return
+	}
+
+	req := &apiRequest{method: method, at: time.Now()}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, files := range r.MultipartForm.File {
+			req.file = files[0].Filename
+		}
+	} else if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.fields = r.Form
+	chatID := req.fields.Get("chat_id")
+
+	api.Lock()
+	blocked := api.blocked[chatID]
+	api.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+
+	api.Lock()
+	defer api.Unlock()
+
+	api.requests = append(api.requests, req)
+
+	if d := api.retryAfter[chatID]; d > 0 {
+		delete(api.retryAfter, chatID)
+		fail(w, http.StatusTooManyRequests, "Too Many Requests", map[string]any{"retry_after": d})
+		return
+	}
+	if api.failing[chatID] {
+		fail(w, http.StatusBadRequest, "Bad Request: chat not found", nil)
+		return
+	}
+
+	api.messageID++
+	id, _ := strconv.ParseInt(chatID, 10, 64)
+	reply(w, map[string]any{"message_id": api.messageID, "date": 0, "chat": map[string]any{"id": id, "type": "private"}})
+}
+
+func reply(w http.ResponseWriter, result any) {
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+func fail(w http.ResponseWriter, code int, description string, parameters map[string]any) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"ok":          false,
+		"error_code":  code,
+		"description": description,
+		"parameters":  parameters,
+	})
+}
+
+func (api *fakeAPI) received() []*apiRequest {
+	api.Lock()
+	defer api.Unlock()
+	return slices.Clone(api.requests)
+}
+
+// fakeScheduler records the added tasks and the registered handlers
+type fakeScheduler struct {
+	tasks    []*scheduler.Task
+	handlers map[string]scheduler.TaskHandler
+	sync.Mutex
+}
+
+func (s *fakeScheduler) AddTask(t *scheduler.Task) {
+	s.Lock()
+	defer s.Unlock()
+	s.tasks = append(s.tasks, t)
+}
+
+func (s *fakeScheduler) RegisterHandler(kind string, h scheduler.TaskHandler) {
+	s.Lock()
+	defer s.Unlock()
+	s.handlers[kind] = h
+}
+
+func newTestBot(t *testing.T, api *fakeAPI, cfg Config) (*Bot, *fakeScheduler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg.Token = testToken
+	cfg.APIEndpoint = api.srv.URL + "/bot%s/%s"
+
+	sh := &fakeScheduler{handlers: make(map[string]scheduler.TaskHandler)}
+	b, err := New(ctx, &cfg, logger.NewDefault(), sh, ratelimit.New(ratelimit.Config{}))
+	if err != nil {
+		t.Fatalf("failed to create bot: %v", err)
+	}
+	t.Cleanup(b.bot.StopReceivingUpdates)
+
+	return b, sh
+}
+
+func chatIDs(requests []*apiRequest) []int64 {
+	ids := make([]int64, 0, len(requests))
+	for _, r := range requests {
+		id, _ := strconv.ParseInt(r.fields.Get("chat_id"), 10, 64)
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestSendTargets(t *testing.T) {
+	cfg := Config{
+		ChatId: []int64{1, 2},
+		Groups: []Group{
+			{Name: "ops", ChatId: []int64{2, 3}},
+			{Name: "family", ChatId: []int64{-100}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		msg   *entity.BotMessage
+		chats []int64
+		err   string
+	}{
+		{name: "configured chats", msg: &entity.BotMessage{Text: "hi"}, chats: []int64{1, 2}},
+		{name: "chats", msg: &entity.BotMessage{Text: "hi", Chats: []int64{5}}, chats: []int64{5}},
+		{name: "group", msg: &entity.BotMessage{Text: "hi", Groups: []string{"ops"}}, chats: []int64{2, 3}},
+		{
+			name:  "chats and groups",
+			msg:   &entity.BotMessage{Text: "hi", Chats: []int64{1, 2}, Groups: []string{"ops", "family"}},
+			chats: []int64{-100, 1, 2, 3},
+		},
+		{name: "unknown group", msg: &entity.BotMessage{Text: "hi", Groups: []string{"nobody"}}, err: "unknown recipient group nobody"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			b, _ := newTestBot(t, api, cfg)
+
+			sent, err := b.Send(tt.msg)
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				if n := len(api.received()); n != 0 {
+					t.Fatalf("expected no requests, got %d", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := chatIDs(api.received()); !slices.Equal(got, tt.chats) {
+				t.Errorf("expected requests to chats %v, got %v", tt.chats, got)
+			}
+			got := make([]int64, 0, len(sent))
+			for _, m := range sent {
+				got = append(got, m.ChatID)
+			}
+			if !slices.Equal(got, tt.chats) {
+				t.Errorf("expected messages sent to chats %v, got %v", tt.chats, got)
+			}
+		})
+	}
+}
+
+func TestSendParseModeAndSilent(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfgMode   string
+		msg       *entity.BotMessage
+		parseMode string
+		silent    string
+	}{
+		{name: "no parse mode", msg: &entity.BotMessage{Text: "hi"}},
+		{name: "configured parse mode", cfgMode: "HTML", msg: &entity.BotMessage{Text: "<b>hi</b>"}, parseMode: "HTML"},
+		{
+			name:      "message parse mode",
+			cfgMode:   "HTML",
+			msg:       &entity.BotMessage{Text: "*hi*", ParseMode: "MarkdownV2"},
+			parseMode: "MarkdownV2",
+		},
+		{
+			name:    "plain text",
+			cfgMode: "MarkdownV2",
+			msg:     &entity.BotMessage{Text: "script_1 (a.lua) - loaded", ParseMode: entity.BotParseModePlain},
+		},
+		{name: "silent", msg: &entity.BotMessage{Text: "hi", Silent: true}, silent: "true"},
+		{
+			name:      "silent photo",
+			cfgMode:   "HTML",
+			msg:       &entity.BotMessage{Text: "hi", Silent: true, File: &entity.Attachment{Name: "a.png", Data: []byte("png")}},
+			parseMode: "HTML",
+			silent:    "true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			b, _ := newTestBot(t, api, Config{ChatId: []int64{1}, ParseMode: tt.cfgMode})
+
+			if _, err := b.Send(tt.msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			requests := api.received()
+			if len(requests) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(requests))
+			}
+			if got := requests[0].fields.Get("parse_mode"); got != tt.parseMode {
+				t.Errorf("expected parse mode %q, got %q", tt.parseMode, got)
+			}
+			if got := requests[0].fields.Get("disable_notification"); got != tt.silent {
+				t.Errorf("expected disable_notification %q, got %q", tt.silent, got)
+			}
+		})
+	}
+}
+
+func TestSendAttachments(t *testing.T) {
+	longText := strings.Repeat("a", captionLimit+1)
+
+	type part struct {
+		method  string
+		file    string
+		caption string
+		fields  map[string]string
+	}
+
+	tests := []struct {
+		name  string
+		msg   *entity.BotMessage
+		parts []part
+	}{
+		{
+			name:  "photo by extension",
+			msg:   &entity.BotMessage{Text: "cam", File: &entity.Attachment{Name: "cam.JPG", Data: []byte("jpg")}},
+			parts: []part{{method: "sendPhoto", file: "cam.JPG", caption: "cam"}},
+		},
+		{
+			name:  "document by extension",
+			msg:   &entity.BotMessage{Text: "log", File: &entity.Attachment{Name: "app.log", Data: []byte("log")}},
+			parts: []part{{method: "sendDocument", file: "app.log", caption: "log"}},
+		},
+		{
+			name: "document by kind",
+			msg: &entity.BotMessage{
+				File:     &entity.Attachment{Name: "cam.png", Data: []byte("png")},
+				FileKind: entity.BotFileDocument,
+			},
+			parts: []part{{method: "sendDocument", file: "cam.png"}},
+		},
+		{
+			name: "photo by kind",
+			msg: &entity.BotMessage{
+				File:     &entity.Attachment{Name: "snapshot", Data: []byte("jpg")},
+				FileKind: entity.BotFilePhoto,
+			},
+			parts: []part{{method: "sendPhoto", file: "snapshot"}},
+		},
+		{
+			name: "long caption",
+			msg:  &entity.BotMessage{Text: longText, File: &entity.Attachment{Name: "cam.jpg", Data: []byte("jpg")}},
+			parts: []part{
+				{method: "sendMessage", fields: map[string]string{"text": longText}},
+				{method: "sendPhoto", file: "cam.jpg"},
+			},
+		},
+		{
+			name: "location",
+			msg:  &entity.BotMessage{Text: "here", Location: &entity.BotLocation{Latitude: 55.75, Longitude: 37.62}},
+			parts: []part{
+				{method: "sendMessage", fields: map[string]string{"text": "here"}},
+				{method: "sendLocation", fields: map[string]string{"latitude": "55.750000", "longitude": "37.620000"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			b, _ := newTestBot(t, api, Config{ChatId: []int64{1}})
+
+			sent, err := b.Send(tt.msg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			requests := api.received()
+			if len(requests) != len(tt.parts) {
+				t.Fatalf("expected %d requests, got %d", len(tt.parts), len(requests))
+			}
+			for i, p := range tt.parts {
+				r := requests[i]
+				if r.method != p.method {
+					t.Errorf("request %d: expected method %s, got %s", i, p.method, r.method)
+				}
+				if r.file != p.file {
+					t.Errorf("request %d: expected file %q, got %q", i, p.file, r.file)
+				}
+				if got := r.fields.Get("caption"); got != p.caption {
+					t.Errorf("request %d: expected caption %q, got %q", i, p.caption, got)
+				}
+				for k, v := range p.fields {
+					if got := r.fields.Get(k); got != v {
+						t.Errorf("request %d: expected %s %q, got %q", i, k, v, got)
+					}
+				}
+			}
+
+			// the id of the last message is returned
+			if len(sent) != 1 || sent[0].MessageID != len(tt.parts) {
+				t.Errorf("expected message id %d, got %+v", len(tt.parts), sent)
+			}
+		})
+	}
+}
+
+func TestSendFileTooLarge(t *testing.T) {
+	api := newFakeAPI(t)
+	b, _ := newTestBot(t, api, Config{ChatId: []int64{1}, MaxFileSize: 2})
+
+	_, err := b.Send(&entity.BotMessage{
+		File:           &entity.Attachment{Name: "cam.jpg", Data: []byte("jpg")},
+		DedupeKey:      "cam",
+		DedupeInterval: time.Minute,
+	})
+	if err == nil {
+		t.Fatal("expected error for the file exceeding MaxFileSize")
+	}
+	if n := len(api.received()); n != 0 {
+		t.Fatalf("expected no requests, got %d", n)
+	}
+
+	// the message which failed to load doesn't suppress the next message with the same key
+	sent, err := b.Send(&entity.BotMessage{Text: "no snapshot", DedupeKey: "cam", DedupeInterval: time.Minute})
+	if err != nil || len(sent) != 1 {
+		t.Fatalf("expected the message to be sent, got %d messages, error %v", len(sent), err)
+	}
+}
+
+func TestSendPartialFailure(t *testing.T) {
+	api := newFakeAPI(t)
+	api.failing["2"] = true
+	b, sh := newTestBot(t, api, Config{})
+
+	sent, err := b.Send(&entity.BotMessage{Text: "hi", Chats: []int64{1, 2, 3}})
+
+	var sendErr *sendError
+	if !errors.As(err, &sendErr) {
+		t.Fatalf("expected sendError, got %v", err)
+	}
+	if !slices.Equal(sendErr.chats, []int64{2}) {
+		t.Errorf("expected failed chats [2], got %v", sendErr.chats)
+	}
+	if len(sent) != 2 || sent[0].ChatID != 1 || sent[1].ChatID != 3 {
+		t.Errorf("expected messages sent to chats 1 and 3, got %+v", sent)
+	}
+	if len(sh.tasks) != 0 {
+		t.Errorf("expected no retries of the synchronous send, got %d", len(sh.tasks))
+	}
+}
+
+func TestRetryFailedChats(t *testing.T) {
+	api := newFakeAPI(t)
+	api.failing["2"] = true
+	_, sh := newTestBot(t, api, Config{Groups: []Group{{Name: "ops", ChatId: []int64{1, 2}}}})
+
+	handler := sh.handlers[taskKindMessage]
+	if handler == nil {
+		t.Fatal("message handler is not registered")
+	}
+
+	payload, _ := json.Marshal(&entity.BotMessage{Text: "hi", Chats: []int64{3}, Groups: []string{"ops"}})
+	if err := handler(payload); err != nil {
+		t.Fatalf("expected the partially sent message to succeed, got %v", err)
+	}
+	if len(sh.tasks) != 1 {
+		t.Fatalf("expected 1 retry task, got %d", len(sh.tasks))
+	}
+
+	retried := &entity.BotMessage{}
+	if err := json.Unmarshal(sh.tasks[0].Payload, retried); err != nil {
+		t.Fatalf("failed to decode retry task: %v", err)
+	}
+	if !slices.Equal(retried.Chats, []int64{2}) || len(retried.Groups) != 0 {
+		t.Errorf("expected retry to chat 2 only, got chats %v groups %v", retried.Chats, retried.Groups)
+	}
+	if sh.tasks[0].Volatile {
+		t.Error("expected the message without attachment to be saved to the store")
+	}
+
+	// the message which was not sent to any chat fails the task without queueing a new one
+	payload, _ = json.Marshal(&entity.BotMessage{Text: "hi", Chats: []int64{2}})
+	if err := handler(payload); err == nil {
+		t.Fatal("expected error for the message which was not sent")
+	}
+	if len(sh.tasks) != 1 {
+		t.Errorf("expected no new retry tasks, got %d", len(sh.tasks)-1)
+	}
+}
+
+func TestRetryAttachmentVolatile(t *testing.T) {
+	api := newFakeAPI(t)
+	api.failing["2"] = true
+	_, sh := newTestBot(t, api, Config{})
+
+	payload, _ := json.Marshal(&entity.BotMessage{
+		Text:  "snapshot",
+		Chats: []int64{1, 2},
+		File:  &entity.Attachment{Name: "cam.jpg", Data: []byte("jpeg")},
+	})
+	if err := sh.handlers[taskKindMessage](payload); err != nil {
+		t.Fatalf("expected the partially sent message to succeed, got %v", err)
+	}
+	if len(sh.tasks) != 1 {
+		t.Fatalf("expected 1 retry task, got %d", len(sh.tasks))
+	}
+	if !sh.tasks[0].Volatile {
+		t.Error("expected the message with attachment not to be saved to the store")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name     string
+		chatID   int64
+		interval time.Duration
+	}{
+		{name: "chat", chatID: 1, interval: chatInterval},
+		{name: "group chat", chatID: -100, interval: groupInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThrottle()
+			if err := th.wait(context.Background(), tt.chatID); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if next := time.Until(th.next[tt.chatID]); next < tt.interval-100*time.Millisecond || next > tt.interval {
+				t.Errorf("expected the next request in %s, got %s", tt.interval, next)
+			}
+
+			// other chats wait for the global interval only
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if err := th.wait(ctx, tt.chatID+1); err != nil {
+				t.Errorf("expected other chat not to wait, got %v", err)
+			}
+			if err := th.wait(ctx, tt.chatID); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected the same chat to wait, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSendThrottled(t *testing.T) {
+	api := newFakeAPI(t)
+	b, _ := newTestBot(t, api, Config{})
+
+	for i := range 2 {
+		if _, err := b.Send(&entity.BotMessage{Text: fmt.Sprint(i), Chats: []int64{1, 2}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	var at = make(map[string][]time.Time)
+	for _, r := range api.received() {
+		at[r.fields.Get("chat_id")] = append(at[r.fields.Get("chat_id")], r.at)
+	}
+
+	if d := at["2"][0].Sub(at["1"][0]); d >= chatInterval/2 {
+		t.Errorf("expected different chats not to wait for each other, got %s", d)
+	}
+	for chatID, times := range at {
+		if d := times[1].Sub(times[0]); d < chatInterval-50*time.Millisecond {
+			t.Errorf("chat %s: expected messages at least %s apart, got %s", chatID, chatInterval, d)
+		}
+	}
+}
+
+func TestSendRetryAfter(t *testing.T) {
+	api := newFakeAPI(t)
+	api.retryAfter["1"] = 1
+	b, _ := newTestBot(t, api, Config{})
+
+	sent, err := b.Send(&entity.BotMessage{Text: "hi", Chats: []int64{1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 sent message, got %d", len(sent))
+	}
+
+	requests := api.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected the request to be repeated once, got %d requests", len(requests))
+	}
+	if d := requests[1].at.Sub(requests[0].at); d < time.Second-50*time.Millisecond {
+		t.Errorf("expected the request to be repeated after 1s, got %s", d)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	api := newFakeAPI(t)
+	b, _ := newTestBot(t, api, Config{
+		ChatId: []int64{100},
+		Users:  []User{{Id: 1, Role: "admin"}, {Id: 2, Role: "viewer"}},
+		Admins: []int64{2, 3},
+	})
+
+	tests := []struct {
+		name   string
+		chatID int64
+		user   *tgbotapi.User
+		role   entity.BotRole
+	}{
+		{name: "user", chatID: 100, user: &tgbotapi.User{ID: 1}, role: entity.BotRoleAdmin},
+		{name: "Users take precedence over Admins", chatID: 100, user: &tgbotapi.User{ID: 2}, role: entity.BotRoleViewer},
+		{name: "deprecated Admins", chatID: 100, user: &tgbotapi.User{ID: 3}, role: entity.BotRoleAdmin},
+		{name: "chat member without Users entry", chatID: 100, user: &tgbotapi.User{ID: 4}, role: entity.BotRoleNone},
+		{name: "no user", chatID: 100, role: entity.BotRoleNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.role(tt.chatID, tt.user); got != tt.role {
+				t.Errorf("expected role %s, got %s", tt.role, got)
+			}
+		})
+	}
+}
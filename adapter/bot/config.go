@@ -3,6 +3,28 @@ package bot
 type Config struct {
 	Token         string
 	ChatId        []int64
+	Groups        []Group
 	UpdateTimeout int
 	PoolSize      int
+	MaxFileSize   int64
+	ParseMode     string
+	APIEndpoint   string
+	Admins        []int64
+	Users         []User
+
+	LiveMessagesFile string
+
+	ReportUnauthorized bool
+}
+
+// User is the Telegram user allowed to interact with the bot
+type User struct {
+	Id   int64
+	Role string
+}
+
+// Group is a named list of chats used as recipients of messages
+type Group struct {
+	Name   string
+	ChatId []int64
 }
@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// liveMessages keeps ids of the messages which are updated in place per key and chat,
+// the ids are saved to the file if it is configured, so the messages are updated after restart
+type liveMessages struct {
+	path string
+	ids  map[string]map[int64]int
+	keys map[string]*sync.Mutex // upserts of the same key are serialized, the mutex of liveMessages guards only the maps
+	sync.Mutex
+}
+
+func newLiveMessages(path string) (*liveMessages, error) {
+	l := &liveMessages{
+		path: path,
+		ids:  make(map[string]map[int64]int),
+		keys: make(map[string]*sync.Mutex),
+	}
+	if len(path) == 0 {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &l.ids); err != nil {
+		return nil, fmt.Errorf("failed to parse live messages file %s: %w", path, err)
+	}
+
+	return l, nil
+}
+
+// lock locks the key and returns the function which unlocks it
+func (l *liveMessages) lock(key string) func() {
+	l.Lock()
+	mu, ok := l.keys[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		l.keys[key] = mu
+	}
+	l.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (l *liveMessages) get(key string, chatID int64) (int, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	id, ok := l.ids[key][chatID]
+	return id, ok
+}
+
+func (l *liveMessages) set(key string, chatID int64, id int) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.ids[key] == nil {
+		l.ids[key] = make(map[int64]int)
+	}
+	l.ids[key][chatID] = id
+}
+
+func (l *liveMessages) save() error {
+	if len(l.path) == 0 {
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	data, err := json.Marshal(l.ids)
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.path)
+}
+
+// Upsert edits the message sent with the key earlier or sends the new one if there is no such message
+// or it was deleted, new messages are pinned if m.Pin is set. Attachments and locations are not supported.
+func (b *Bot) Upsert(key string, m *entity.BotMessage) ([]*entity.BotSentMessage, error) {
+	if err := b.checkGroups(m); err != nil {
+		return nil, err
+	}
+	if m.File != nil || m.Location != nil {
+		return nil, errors.New("live messages can't contain attachments and locations")
+	}
+
+	unlock := b.live.lock(key)
+	defer unlock()
+
+	var sendErr *sendError
+	chats := b.chats(m)
+	sent := make([]*entity.BotSentMessage, 0, len(chats))
+	for _, chatID := range chats {
+		id, err := b.upsert(key, chatID, m)
+		if err != nil {
+			if sendErr == nil {
+				sendErr = &sendError{err: err}
+			}
+			sendErr.chats = append(sendErr.chats, chatID)
+			continue
+		}
+		sent = append(sent, &entity.BotSentMessage{ChatID: chatID, MessageID: id})
+	}
+
+	// the messages sent to other chats are saved even if some chats failed
+	if err := b.live.save(); err != nil {
+		b.log.Error().Err(err).Str("path", b.cfg.LiveMessagesFile).Msg("failed to save live messages")
+	}
+
+	if sendErr != nil {
+		return sent, sendErr
+	}
+
+	return sent, nil
+}
+
+func (b *Bot) upsert(key string, chatID int64, m *entity.BotMessage) (int, error) {
+	if id, ok := b.live.get(key, chatID); ok {
+		err := b.EditMessage(chatID, id, m)
+		switch {
+		case err == nil || isTelegramError(err, "message is not modified"):
+			return id, nil
+		case !isTelegramError(err, "message to edit not found", "message can't be edited"):
+			return 0, err
+		}
+		b.log.Info().Str("key", key).Int64("chat_id", chatID).Msg("live message was deleted, sending the new one")
+	}
+
+	id, err := b.send(chatID, m)
+	if err != nil {
+		return 0, err
+	}
+	b.live.set(key, chatID, id)
+
+	if m.Pin {
+		if err := b.pin(chatID, id); err != nil {
+			b.log.Error().Err(err).Str("key", key).Int64("chat_id", chatID).Msg("failed to pin live message")
+		}
+	}
+
+	return id, nil
+}
+
+func (b *Bot) pin(chatID int64, messageID int) error {
+	_, err := b.call(chatID, tgbotapi.PinChatMessageConfig{ChatID: chatID, MessageID: messageID, DisableNotification: true})
+	return err
+}
+
+// isTelegramError reports whether the error returned by the Bot API contains one of the descriptions
+func isTelegramError(err error, descriptions ...string) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return false
+	}
+	for _, d := range descriptions {
+		if strings.Contains(tgErr.Message, d) {
+			return true
+		}
+	}
+	return false
+}
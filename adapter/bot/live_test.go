@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+func TestUpsertPartialFailure(t *testing.T) {
+	api := newFakeAPI(t)
+	api.failing["2"] = true
+	path := filepath.Join(t.TempDir(), "live.json")
+	b, _ := newTestBot(t, api, Config{LiveMessagesFile: path})
+
+	sent, err := b.Upsert("status", &entity.BotMessage{Text: "on", Chats: []int64{1, 2, 3}})
+
+	var e *sendError
+	if !errors.As(err, &e) || !slices.Equal(e.chats, []int64{2}) {
+		t.Fatalf("expected the error of chat 2, got %v", err)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 sent messages, got %d", len(sent))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("live messages are not saved: %v", err)
+	}
+	var ids map[string]map[int64]int
+	if err := json.Unmarshal(data, &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids["status"]) != 2 || ids["status"][1] == 0 || ids["status"][3] == 0 {
+		t.Fatalf("unexpected saved messages %v", ids)
+	}
+}
+
+func TestUpsertEditsSentMessage(t *testing.T) {
+	api := newFakeAPI(t)
+	b, _ := newTestBot(t, api, Config{})
+
+	first, err := b.Upsert("status", &entity.BotMessage{Text: "on", Chats: []int64{1}, Pin: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := b.Upsert("status", &entity.BotMessage{Text: "off", Chats: []int64{1}, Pin: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first[0].MessageID != second[0].MessageID {
+		t.Fatalf("expected the message %d to be edited, got %d", first[0].MessageID, second[0].MessageID)
+	}
+
+	methods := make([]string, 0, 3)
+	for _, r := range api.received() {
+		methods = append(methods, r.method)
+	}
+	if !slices.Equal(methods, []string{"sendMessage", "pinChatMessage", "editMessageText"}) {
+		t.Fatalf("unexpected requests %v", methods)
+	}
+}
+
+func TestUpsertDoesNotBlockOtherKeys(t *testing.T) {
+	api := newFakeAPI(t)
+	blocked := make(chan struct{})
+	api.blocked["1"] = blocked
+	b, _ := newTestBot(t, api, Config{})
+
+	// the update of the key waits for the response
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = b.Upsert("a", &entity.BotMessage{Text: "1", Chats: []int64{1}})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	other := make(chan error, 1)
+	go func() {
+		_, err := b.Upsert("b", &entity.BotMessage{Text: "1", Chats: []int64{2}})
+		other <- err
+	}()
+
+	select {
+	case err := <-other:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the other key waits for the pending update")
+	}
+
+	close(blocked)
+	<-done
+}
+
+func TestDeleteMessageRetryAfter(t *testing.T) {
+	api := newFakeAPI(t)
+	api.retryAfter["1"] = 1
+	b, _ := newTestBot(t, api, Config{})
+
+	if err := b.DeleteMessage(1, 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests := api.received()
+	if len(requests) != 2 || requests[1].method != "deleteMessage" {
+		t.Fatalf("expected the request to be repeated once, got %d requests", len(requests))
+	}
+}
@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/metrics"
+	"github.com/forest33/honeybee/pkg/structs"
+)
+
+// sendError is returned if the message was not sent to some of the chats
+type sendError struct {
+	chats []int64
+	err   error // the error of the first failed chat
+}
+
+func (e *sendError) Error() string {
+	return fmt.Sprintf("failed to send message to chats %v: %v", e.chats, e.err)
+}
+
+func (e *sendError) Unwrap() error {
+	return e.err
+}
+
+// sendMessage sends the message to every chat, failed chats don't stop sending to the rest of them
+func (b *Bot) sendMessage(m *entity.BotMessage) ([]*entity.BotSentMessage, error) {
+	if b.bot == nil {
+		return nil, errors.New("bot not initialized")
+	}
+
+	var sendErr *sendError
+	chats := b.chats(m)
+	sent := make([]*entity.BotSentMessage, 0, len(chats))
+	for _, chatID := range chats {
+		id, err := b.send(chatID, m)
+		metrics.TelegramDeliveries.WithLabelValues(metrics.Result(err)).Inc()
+		if err != nil {
+			if sendErr == nil {
+				sendErr = &sendError{err: err}
+			}
+			sendErr.chats = append(sendErr.chats, chatID)
+			continue
+		}
+		sent = append(sent, &entity.BotSentMessage{ChatID: chatID, MessageID: id})
+	}
+
+	if sendErr != nil {
+		return sent, sendErr
+	}
+
+	return sent, nil
+}
+
+// chats returns the chats of the message and its groups or all configured chats
+func (b *Bot) chats(m *entity.BotMessage) []int64 {
+	if len(m.Chats) == 0 && len(m.Groups) == 0 {
+		return b.cfg.ChatId
+	}
+
+	chats := slices.Clone(m.Chats)
+	for _, g := range m.Groups {
+		chats = append(chats, b.groups[g]...)
+	}
+	slices.Sort(chats)
+
+	return slices.Compact(chats)
+}
+
+// send sends the text, the attachment with the text as the caption and the location, the text which doesn't fit
+// into the caption is sent as a separate message. The keyboard is attached to the last message, its id is returned.
+func (b *Bot) send(chatID int64, m *entity.BotMessage) (int, error) {
+	var (
+		parts     []tgbotapi.Chattable
+		bases     []*tgbotapi.BaseChat
+		parseMode = b.parseMode(m)
+		separate  = utf8.RuneCountInString(m.Text) > captionLimit
+	)
+
+	if len(m.Text) != 0 && (m.File == nil || separate) {
+		msg := tgbotapi.NewMessage(chatID, m.Text)
+		msg.ParseMode = parseMode
+		parts, bases = append(parts, &msg), append(bases, &msg.BaseChat)
+	}
+
+	if m.File != nil {
+		file := tgbotapi.FileBytes{Name: m.File.FileName(), Bytes: m.File.Data}
+		caption := structs.If(separate, "", m.Text)
+		if isPhoto(m.FileKind, file) {
+			photo := tgbotapi.NewPhoto(chatID, file)
+			photo.Caption, photo.ParseMode = caption, parseMode
+			parts, bases = append(parts, &photo), append(bases, &photo.BaseChat)
+		} else {
+			doc := tgbotapi.NewDocument(chatID, file)
+			doc.Caption, doc.ParseMode = caption, parseMode
+			parts, bases = append(parts, &doc), append(bases, &doc.BaseChat)
+		}
+	}
+
+	if m.Location != nil {
+		loc := tgbotapi.NewLocation(chatID, m.Location.Latitude, m.Location.Longitude)
+		parts, bases = append(parts, &loc), append(bases, &loc.BaseChat)
+	}
+
+	if len(parts) == 0 {
+		return 0, errors.New("empty message")
+	}
+
+	for _, base := range bases {
+		base.DisableNotification = m.Silent
+	}
+	if kb := keyboard(m.Keyboard); kb != nil {
+		bases[len(bases)-1].ReplyMarkup = kb
+	}
+
+	var sent tgbotapi.Message
+	for _, p := range parts {
+		var err error
+		if sent, err = b.request(chatID, p); err != nil {
+			return 0, err
+		}
+	}
+
+	return sent.MessageID, nil
+}
+
+// request sends the request through call and returns the sent or edited message
+func (b *Bot) request(chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+
+	resp, err := b.call(chatID, c)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(resp.Result, &msg)
+
+	return msg, err
+}
+
+// call sends the request when the chat limits allow it, the request rejected by Telegram with "Too Many Requests"
+// is repeated once after the specified delay
+func (b *Bot) call(chatID int64, c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := b.throttle.wait(b.ctx, chatID); err != nil {
+			return nil, err
+		}
+
+		resp, err := b.bot.Request(c)
+
+		var tgErr *tgbotapi.Error
+		if attempt == 0 && errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+			b.log.Warn().Int64("chat_id", chatID).Int("retry_after", tgErr.RetryAfter).Msg("Telegram rate limit exceeded")
+			b.throttle.delay(chatID, time.Duration(tgErr.RetryAfter)*time.Second)
+			continue
+		}
+
+		return resp, err
+	}
+}
+
+// parseMode returns the parse mode of the message, the text is sent without parse mode if it is Plain
+func (b *Bot) parseMode(m *entity.BotMessage) string {
+	mode := structs.If(len(m.ParseMode) != 0, m.ParseMode, b.cfg.ParseMode)
+	return structs.If(mode == entity.BotParseModePlain, "", mode)
+}
+
+func isPhoto(kind string, file tgbotapi.FileBytes) bool {
+	switch kind {
+	case entity.BotFilePhoto:
+		return true
+	case entity.BotFileDocument:
+		return false
+	}
+	_, ok := photoExt[strings.ToLower(filepath.Ext(file.Name))]
+	return ok && len(file.Bytes) <= photoSizeLimit
+}
+
+// keyboard converts rows of buttons to the inline keyboard markup, nil is returned for the empty keyboard
+func keyboard(rows [][]*entity.BotButton) *tgbotapi.InlineKeyboardMarkup {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	markup := make([][]tgbotapi.InlineKeyboardButton, 0, len(rows))
+	for _, row := range rows {
+		buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(row))
+		for _, btn := range row {
+			if len(btn.URL) != 0 {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL(btn.Text, btn.URL))
+			} else {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(btn.Text, btn.Data))
+			}
+		}
+		markup = append(markup, buttons)
+	}
+
+	return &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: markup}
+}
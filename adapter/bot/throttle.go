@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/forest33/honeybee/pkg/structs"
+)
+
+// limits of the Bot API, https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	chatInterval   = time.Second      // one message per second to the chat
+	groupInterval  = 3 * time.Second  // 20 messages per minute to the group
+	globalInterval = time.Second / 30 // 30 messages per second overall
+	throttlePrune  = 10 * time.Minute
+)
+
+// throttle spaces out requests so that the Telegram limits are not exceeded, requests wait for their turn
+type throttle struct {
+	next     map[int64]time.Time
+	global   time.Time
+	prunedAt time.Time
+	sync.Mutex
+}
+
+func newThrottle() *throttle {
+	return &throttle{
+		next:     make(map[int64]time.Time),
+		prunedAt: time.Now(),
+	}
+}
+
+// wait reserves the time slot for the request to the chat and waits for it, group chats have negative ids
+func (t *throttle) wait(ctx context.Context, chatID int64) error {
+	t.Lock()
+	now := time.Now()
+	t.prune(now)
+	at := latest(now, t.next[chatID], t.global)
+	t.next[chatID] = at.Add(structs.If(chatID < 0, groupInterval, chatInterval))
+	t.global = at.Add(globalInterval)
+	t.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// delay postpones requests to the chat, it is used when Telegram asks to retry later
+func (t *throttle) delay(chatID int64, d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.next[chatID] = latest(t.next[chatID], time.Now().Add(d))
+}
+
+func latest(times ...time.Time) time.Time {
+	var l time.Time
+	for _, t := range times {
+		if t.After(l) {
+			l = t
+		}
+	}
+	return l
+}
+
+func (t *throttle) prune(now time.Time) {
+	if now.Sub(t.prunedAt) < throttlePrune {
+		return
+	}
+	t.prunedAt = now
+
+	for chatID, next := range t.next {
+		if next.Before(now) {
+			delete(t.next, chatID)
+		}
+	}
+}
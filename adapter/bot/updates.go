@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/structs"
+)
+
+// SubscribeCommands passes messages of the authorized users to the handler, updates are read after the first subscription
+func (b *Bot) SubscribeCommands(handler func(c *entity.BotCommand)) {
+	b.commandHandler.Store(&handler)
+	b.readOnce.Do(func() { go b.readUpdates() })
+}
+
+// SubscribeCallbacks passes callback queries of the inline keyboards to the handler
+func (b *Bot) SubscribeCallbacks(handler func(c *entity.BotCallback)) {
+	b.callbackHandler.Store(&handler)
+	b.readOnce.Do(func() { go b.readUpdates() })
+}
+
+func (b *Bot) readUpdates() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			b.bot.StopReceivingUpdates()
+			return
+		case u, ok := <-b.updates:
+			if !ok {
+				return
+			}
+			switch {
+			case u.Message != nil:
+				b.message(u.Message)
+			case u.CallbackQuery != nil:
+				b.callback(u.CallbackQuery)
+			}
+		}
+	}
+}
+
+func (b *Bot) message(m *tgbotapi.Message) {
+	role := b.role(m.Chat.ID, m.From)
+	if role == entity.BotRoleNone {
+		b.unauthorized(m.Chat.ID, m.From, m.Text, "message from unauthorized user")
+		return
+	}
+
+	if h := b.commandHandler.Load(); h != nil {
+		c := newBotCommand(m)
+		c.Role = role
+		(*h)(c)
+	}
+}
+
+// callback passes the callback query of the user to the handler, viewers can't press buttons
+func (b *Bot) callback(q *tgbotapi.CallbackQuery) {
+	var chatID int64
+	if q.Message != nil {
+		chatID = q.Message.Chat.ID
+	}
+
+	role := b.role(chatID, q.From)
+	allowed := q.Message != nil && role >= entity.BotRoleUser
+
+	// the button shows the progress indicator until the callback query is answered
+	if _, err := b.bot.Request(tgbotapi.NewCallback(q.ID, structs.If(allowed, "", "Permission denied"))); err != nil {
+		b.log.Error().Err(err).Msg("failed to answer callback query")
+	}
+
+	switch {
+	case role == entity.BotRoleNone:
+		b.unauthorized(chatID, q.From, q.Data, "callback query from unauthorized user")
+		return
+	case !allowed:
+		b.log.Warn().Int64("user_id", q.From.ID).Str("user", userName(q.From)).Str("data", q.Data).Msg("callback query is not allowed")
+		return
+	}
+
+	if h := b.callbackHandler.Load(); h != nil {
+		(*h)(&entity.BotCallback{
+			ID:        q.ID,
+			ChatID:    q.Message.Chat.ID,
+			MessageID: q.Message.MessageID,
+			UserID:    q.From.ID,
+			UserName:  userName(q.From),
+			Role:      role,
+			Data:      q.Data,
+		})
+	}
+}
+
+func newBotCommand(m *tgbotapi.Message) *entity.BotCommand {
+	c := &entity.BotCommand{
+		ChatID:    m.Chat.ID,
+		MessageID: m.MessageID,
+		Text:      m.Text,
+	}
+	if m.From != nil {
+		c.UserID = m.From.ID
+		c.UserName = userName(m.From)
+	}
+	if m.IsCommand() {
+		c.Command = "/" + m.Command()
+		c.Args = strings.Fields(m.CommandArguments())
+	}
+	return c
+}
+
+func userName(u *tgbotapi.User) string {
+	if u == nil {
+		return ""
+	}
+	if len(u.UserName) != 0 {
+		return u.UserName
+	}
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
@@ -0,0 +1,264 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/forest33/honeybee/adapter/mqtt"
+	"github.com/forest33/honeybee/pkg/codec"
+	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/metrics"
+)
+
+const (
+	resultForwarded = "forwarded"
+	resultDropped   = "dropped"
+	resultFailed    = "failed"
+)
+
+// Bridge mirrors messages between MQTT brokers
+type Bridge struct {
+	ctx     context.Context
+	cfg     *Config
+	log     *logger.Logger
+	clients map[string]*mqtt.Client
+	rules   []*rule
+	loops   *loopFilter
+}
+
+type rule struct {
+	Rule
+	prefix    string
+	topic     *template.Template
+	received  atomic.Int64
+	forwarded atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+}
+
+// Stats contains the message counters of the bridge rule
+type Stats struct {
+	Rule      string `json:"rule"`
+	Received  int64  `json:"received"`
+	Forwarded int64  `json:"forwarded"`
+	Dropped   int64  `json:"dropped"`
+	Failed    int64  `json:"failed"`
+}
+
+type topicData struct {
+	Topic  string
+	Prefix string
+	Suffix string
+	Levels []string
+}
+
+var templateFuncs = template.FuncMap{
+	"replace":    strings.ReplaceAll,
+	"trimPrefix": strings.TrimPrefix,
+	"trimSuffix": strings.TrimSuffix,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+}
+
+func New(ctx context.Context, cfg *Config, log *logger.Logger, codec codec.Codec) (*Bridge, error) {
+	cfg.normalize()
+
+	b := &Bridge{
+		ctx:     ctx,
+		cfg:     cfg,
+		log:     log,
+		clients: make(map[string]*mqtt.Client, len(cfg.Brokers)),
+		rules:   make([]*rule, 0, len(cfg.Rules)),
+		loops:   newLoopFilter(cfg.LoopTTL),
+	}
+
+	for i := range cfg.Brokers {
+		cli, err := mqtt.New(ctx, &cfg.Brokers[i].Config, log, codec)
+		if err != nil {
+			return nil, err
+		}
+		b.clients[cfg.Brokers[i].Name] = cli
+	}
+
+	for _, r := range cfg.Rules {
+		if _, ok := b.clients[r.Source]; !ok {
+			return nil, fmt.Errorf("unknown source broker %s in bridge rule %s", r.Source, r.Name)
+		}
+		if _, ok := b.clients[r.Destination]; !ok {
+			return nil, fmt.Errorf("unknown destination broker %s in bridge rule %s", r.Destination, r.Name)
+		}
+
+		br := &rule{
+			Rule:   r,
+			prefix: filterPrefix(r.Filter),
+		}
+		if len(r.Topic) != 0 {
+			t, err := template.New(r.Name).Funcs(templateFuncs).Parse(r.Topic)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse topic template of bridge rule %s: %w", r.Name, err)
+			}
+			br.topic = t
+		}
+
+		b.rules = append(b.rules, br)
+	}
+
+	return b, nil
+}
+
+// Start connects to the brokers and starts forwarding messages
+func (b *Bridge) Start() error {
+	for name, cli := range b.clients {
+		cli.SetConnectHandler(func() {
+			b.subscribe(name)
+		})
+		if err := cli.Connect(); err != nil {
+			return err
+		}
+	}
+
+	go b.housekeeping()
+
+	b.log.Info().Int("brokers", len(b.clients)).Int("rules", len(b.rules)).Msg("MQTT bridge started")
+
+	return nil
+}
+
+// Stats returns the message counters of all rules
+func (b *Bridge) Stats() []*Stats {
+	stats := make([]*Stats, 0, len(b.rules))
+	for _, r := range b.rules {
+		stats = append(stats, &Stats{
+			Rule:      r.Name,
+			Received:  r.received.Load(),
+			Forwarded: r.forwarded.Load(),
+			Dropped:   r.dropped.Load(),
+			Failed:    r.failed.Load(),
+		})
+	}
+	return stats
+}
+
+func (b *Bridge) subscribe(broker string) {
+	filters := make(map[string][]*rule, len(b.rules))
+	for _, r := range b.rules {
+		if r.Source == broker {
+			filters[r.Filter] = append(filters[r.Filter], r)
+		}
+	}
+
+	for filter, rules := range filters {
+		var qos byte
+		for _, r := range rules {
+			qos = max(qos, r.QoS)
+		}
+
+		if err := b.clients[broker].SubscribeRaw(filter, qos, func(m *mqtt.RawMessage) {
+			for _, r := range rules {
+				b.forward(r, m)
+			}
+		}); err != nil {
+			b.log.Error().Err(err).Str("broker", broker).Str("filter", filter).Msg("failed to subscribe bridge rule")
+			continue
+		}
+
+		b.log.Info().Str("broker", broker).Str("filter", filter).Msg("bridge subscribed to topic")
+	}
+}
+
+func (b *Bridge) forward(r *rule, m *mqtt.RawMessage) {
+	r.received.Add(1)
+	metrics.BridgeReceived.WithLabelValues(r.Name).Inc()
+
+	if b.loops.seen(r.Source, m.Topic, m.Payload) {
+		r.count(&r.dropped, resultDropped)
+		b.log.Debug().Str("rule", r.Name).Str("topic", m.Topic).Msg("bridge loop detected, message dropped")
+		return
+	}
+
+	topic, err := r.rewrite(m.Topic)
+	if err != nil {
+		r.count(&r.failed, resultFailed)
+		b.log.Error().Err(err).Str("rule", r.Name).Str("topic", m.Topic).Msg("failed to rewrite topic")
+		return
+	}
+
+	b.loops.add(r.Destination, topic, m.Payload)
+
+	if err := b.clients[r.Destination].PublishRaw(topic, r.QoS, r.Retain && m.Retained, m.Payload); err != nil {
+		r.count(&r.failed, resultFailed)
+		b.log.Error().Err(err).Str("rule", r.Name).Str("topic", topic).Msg("failed to forward message")
+		return
+	}
+
+	r.count(&r.forwarded, resultForwarded)
+
+	b.log.Debug().
+		Str("rule", r.Name).
+		Str("source_topic", m.Topic).
+		Str("destination_topic", topic).
+		Msg("message forwarded")
+}
+
+func (b *Bridge) housekeeping() {
+	statsTicker := time.NewTicker(b.cfg.StatsInterval)
+	defer statsTicker.Stop()
+	loopsTicker := time.NewTicker(b.cfg.LoopTTL)
+	defer loopsTicker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-loopsTicker.C:
+			b.loops.cleanup()
+		case <-statsTicker.C:
+			for _, st := range b.Stats() {
+				b.log.Info().
+					Str("rule", st.Rule).
+					Int64("received", st.Received).
+					Int64("forwarded", st.Forwarded).
+					Int64("dropped", st.Dropped).
+					Int64("failed", st.Failed).
+					Msg("bridge statistics")
+			}
+		}
+	}
+}
+
+// count increments the counter of the rule and the metric of the result
+func (r *rule) count(counter *atomic.Int64, result string) {
+	counter.Add(1)
+	metrics.BridgeMessages.WithLabelValues(r.Name, result).Inc()
+}
+
+func (r *rule) rewrite(topic string) (string, error) {
+	if r.topic == nil {
+		return topic, nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.topic.Execute(buf, &topicData{
+		Topic:  topic,
+		Prefix: r.prefix,
+		Suffix: strings.TrimPrefix(topic, r.prefix),
+		Levels: strings.Split(topic, "/"),
+	}); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// filterPrefix returns the static part of the topic filter before the first wildcard
+func filterPrefix(filter string) string {
+	if idx := strings.IndexAny(filter, "+#"); idx >= 0 {
+		return filter[:idx]
+	}
+	return filter
+}
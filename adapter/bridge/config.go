@@ -0,0 +1,43 @@
+package bridge
+
+import (
+	"time"
+
+	"github.com/forest33/honeybee/adapter/mqtt"
+)
+
+const (
+	defaultStatsInterval = 5 * time.Minute
+	defaultLoopTTL       = 10 * time.Second
+)
+
+type Config struct {
+	Brokers       []Broker
+	Rules         []Rule
+	StatsInterval time.Duration
+	LoopTTL       time.Duration
+}
+
+type Broker struct {
+	Name string
+	mqtt.Config
+}
+
+type Rule struct {
+	Name        string
+	Source      string
+	Destination string
+	Filter      string
+	Topic       string
+	QoS         byte
+	Retain      bool
+}
+
+func (c *Config) normalize() {
+	if c.StatsInterval == 0 {
+		c.StatsInterval = defaultStatsInterval
+	}
+	if c.LoopTTL == 0 {
+		c.LoopTTL = defaultLoopTTL
+	}
+}
@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// loopFilter remembers forwarded messages to drop them when they come back from the destination broker
+type loopFilter struct {
+	ttl  time.Duration
+	data map[uint64]time.Time
+	sync.Mutex
+}
+
+func newLoopFilter(ttl time.Duration) *loopFilter {
+	return &loopFilter{
+		ttl:  ttl,
+		data: make(map[uint64]time.Time),
+	}
+}
+
+func (f *loopFilter) add(broker, topic string, payload []byte) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.data[loopKey(broker, topic, payload)] = time.Now().Add(f.ttl)
+}
+
+// seen reports whether the message was forwarded to the broker within the TTL, the key is kept until it expires
+// because the message comes back once per rule and per subscription matching it
+func (f *loopFilter) seen(broker, topic string, payload []byte) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	expire, ok := f.data[loopKey(broker, topic, payload)]
+
+	return ok && time.Now().Before(expire)
+}
+
+func (f *loopFilter) cleanup() {
+	f.Lock()
+	defer f.Unlock()
+
+	now := time.Now()
+	for k, expire := range f.data {
+		if now.After(expire) {
+			delete(f.data, k)
+		}
+	}
+}
+
+func loopKey(broker, topic string, payload []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(broker))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(topic))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(payload)
+	return h.Sum64()
+}
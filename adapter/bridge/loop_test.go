@@ -0,0 +1,33 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoopFilter(t *testing.T) {
+	f := newLoopFilter(50 * time.Millisecond)
+	f.add("remote", "home/state", []byte("on"))
+
+	// the forwarded message may come back several times, e.g. through two rules with overlapping filters
+	for i := 0; i < 2; i++ {
+		if !f.seen("remote", "home/state", []byte("on")) {
+			t.Fatalf("lookup %d: forwarded message is not detected", i+1)
+		}
+	}
+	if f.seen("local", "home/state", []byte("on")) {
+		t.Fatal("message of the other broker is detected")
+	}
+	if f.seen("remote", "home/state", []byte("off")) {
+		t.Fatal("message with the other payload is detected")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if f.seen("remote", "home/state", []byte("on")) {
+		t.Fatal("expired message is detected")
+	}
+	f.cleanup()
+	if len(f.data) != 0 {
+		t.Fatal("expired message is not removed")
+	}
+}
@@ -0,0 +1,165 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/hooks/storage/bolt"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	mqttClient "github.com/forest33/honeybee/adapter/mqtt"
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/codec"
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+// Broker is an in-process MQTT broker, it is also used as an MQTT client by scripts
+type Broker struct {
+	cfg                    *Config
+	log                    *logger.Logger
+	srv                    *mqtt.Server
+	codec                  codec.Codec
+	externalConnectHandler mqttClient.ConnectHandler
+	subscriptions          *sync.Map
+	subscriptionID         atomic.Int64
+	running                atomic.Bool
+}
+
+func New(ctx context.Context, cfg *Config, log *logger.Logger, codec codec.Codec) (*Broker, error) {
+	cfg.normalize()
+
+	b := &Broker{
+		cfg:           cfg,
+		log:           log,
+		codec:         codec,
+		subscriptions: &sync.Map{},
+		srv: mqtt.New(&mqtt.Options{
+			InlineClient: true,
+			Logger:       newSlogLogger(log),
+		}),
+	}
+
+	if err := b.init(); err != nil {
+		return nil, err
+	}
+
+	entity.GetWg(ctx).Add(1)
+	go func() {
+		<-ctx.Done()
+		b.Close()
+		log.Info().Msg("MQTT broker stopped")
+		entity.GetWg(ctx).Done()
+	}()
+
+	return b, nil
+}
+
+func (b *Broker) init() error {
+	if len(b.cfg.AuthFile) != 0 {
+		data, err := os.ReadFile(b.cfg.AuthFile)
+		if err != nil {
+			return fmt.Errorf("failed to read broker auth file: %w", err)
+		}
+		if err := b.srv.AddHook(new(auth.Hook), &auth.Options{Data: data}); err != nil {
+			return err
+		}
+	} else if err := b.srv.AddHook(new(auth.AllowHook), nil); err != nil {
+		return err
+	}
+
+	if len(b.cfg.StorePath) != 0 {
+		if err := b.srv.AddHook(new(bolt.Hook), &bolt.Options{Path: b.cfg.StorePath}); err != nil {
+			return fmt.Errorf("failed to open broker store: %w", err)
+		}
+	}
+
+	for i, l := range b.cfg.Listeners {
+		lc := listeners.Config{
+			ID:      fmt.Sprintf("%s%d", l.Type, i),
+			Address: l.Address,
+		}
+
+		var listener listeners.Listener
+		switch strings.ToLower(l.Type) {
+		case listeners.TypeTCP:
+			listener = listeners.NewTCP(lc)
+		case listeners.TypeWS:
+			listener = listeners.NewWebsocket(lc)
+		case listeners.TypeUnix:
+			listener = listeners.NewUnixSock(lc)
+		default:
+			return fmt.Errorf("unknown broker listener type: %s", l.Type)
+		}
+
+		if err := b.srv.AddListener(listener); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Broker) Connect() error {
+	if err := b.srv.Serve(); err != nil {
+		return err
+	}
+
+	b.running.Store(true)
+	b.log.Info().Int("listeners", len(b.cfg.Listeners)).Msg("MQTT broker started")
+
+	if b.externalConnectHandler != nil {
+		b.externalConnectHandler()
+	}
+
+	return nil
+}
+
+func (b *Broker) Publish(topic string, payload []byte) error {
+	return b.srv.Publish(topic, payload, false, 0)
+}
+
+func (b *Broker) Subscribe(topic string, handler mqttClient.MessageHandler) error {
+	_, exists := b.subscriptions.LoadOrStore(topic, struct{}{})
+	if exists {
+		return nil
+	}
+
+	return b.srv.Subscribe(topic, int(b.subscriptionID.Add(1)), func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		m, err := mqttClient.NewMessage(b.codec, topic, &mqttClient.RawMessage{
+			Topic:     pk.TopicName,
+			Payload:   pk.Payload,
+			QoS:       pk.FixedHeader.Qos,
+			Retained:  pk.FixedHeader.Retain,
+			Duplicate: pk.FixedHeader.Dup,
+			MessageID: pk.PacketID,
+		})
+		if err != nil {
+			b.log.Error().Err(err).Str("topic", topic).Str("payload", string(pk.Payload)).Msg("failed to create message")
+			return
+		}
+		handler(m)
+	})
+}
+
+// IsConnected reports whether the broker is running, scripts are connected to it in-process
+func (b *Broker) IsConnected() bool {
+	return b.running.Load()
+}
+
+func (b *Broker) SetConnectHandler(h mqttClient.ConnectHandler) {
+	b.externalConnectHandler = h
+}
+
+func (b *Broker) Close() {
+	b.running.Store(false)
+	if err := b.srv.Close(); err != nil {
+		b.log.Error().Err(err).Msg("failed to stop MQTT broker")
+	}
+}
@@ -0,0 +1,28 @@
+package broker
+
+const (
+	defaultListenerType    = "tcp"
+	defaultListenerAddress = ":1883"
+)
+
+type Config struct {
+	Listeners []Listener
+	AuthFile  string
+	StorePath string
+}
+
+type Listener struct {
+	Type    string
+	Address string
+}
+
+func (c *Config) normalize() {
+	if len(c.Listeners) == 0 {
+		c.Listeners = []Listener{{Type: defaultListenerType, Address: defaultListenerAddress}}
+	}
+	for i := range c.Listeners {
+		if len(c.Listeners[i].Type) == 0 {
+			c.Listeners[i].Type = defaultListenerType
+		}
+	}
+}
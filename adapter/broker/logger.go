@@ -0,0 +1,61 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rs/zerolog"
+
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+// slogHandler passes the broker log records to the application logger
+type slogHandler struct {
+	log   *logger.Logger
+	attrs []slog.Attr
+}
+
+func newSlogLogger(log *logger.Logger) *slog.Logger {
+	return slog.New(&slogHandler{log: log})
+}
+
+func (h *slogHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	var e *zerolog.Event
+	switch {
+	case r.Level >= slog.LevelError:
+		e = h.log.Error()
+	case r.Level >= slog.LevelWarn:
+		e = h.log.Warn()
+	case r.Level >= slog.LevelInfo:
+		e = h.log.Info()
+	default:
+		e = h.log.Debug()
+	}
+
+	e = e.Str("module", "broker")
+	for _, a := range h.attrs {
+		e = e.Interface(a.Key, a.Value.Any())
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		e = e.Interface(a.Key, a.Value.Any())
+		return true
+	})
+	e.Msg(r.Message)
+
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &slogHandler{
+		log:   h.log,
+		attrs: append(append(make([]slog.Attr, 0, len(h.attrs)+len(attrs)), h.attrs...), attrs...),
+	}
+}
+
+func (h *slogHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
@@ -24,6 +24,7 @@ type Client struct {
 }
 
 type MessageHandler func(m entity.MQTTMessage)
+type RawMessageHandler func(m *RawMessage)
 type ConnectHandler func()
 type DisconnectHandler func()
 
@@ -78,6 +79,16 @@ func (c *Client) Publish(topic string, payload []byte) error {
 	return nil
 }
 
+// PublishRaw publishes the payload with the given QoS and retained flag
+func (c *Client) PublishRaw(topic string, qos byte, retained bool, payload []byte) error {
+	token := c.cli.Publish(topic, qos, retained, payload)
+	if token.WaitTimeout(c.cfg.Timeout) && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
+
 func (c *Client) Subscribe(topic string, handler MessageHandler) error {
 	_, exists := c.subscriptions.LoadOrStore(topic, struct{}{})
 	if exists {
@@ -85,7 +96,7 @@ func (c *Client) Subscribe(topic string, handler MessageHandler) error {
 	}
 
 	token := c.cli.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
-		m, err := c.newMessage(topic, msg.Payload())
+		m, err := c.newMessage(topic, newRawMessage(msg))
 		if err != nil {
 			c.log.Error().Err(err).Str("topic", topic).Str("payload", string(msg.Payload())).Msg("failed to create message")
 			return
@@ -99,6 +110,23 @@ func (c *Client) Subscribe(topic string, handler MessageHandler) error {
 	return nil
 }
 
+// SubscribeRaw subscribes to the topic filter, payloads are passed to the handler without decoding
+func (c *Client) SubscribeRaw(topic string, qos byte, handler RawMessageHandler) error {
+	_, exists := c.subscriptions.LoadOrStore(topic, struct{}{})
+	if exists {
+		return nil
+	}
+
+	token := c.cli.Subscribe(topic, qos, func(client mqtt.Client, msg mqtt.Message) {
+		handler(newRawMessage(msg))
+	})
+	if token.WaitTimeout(c.cfg.Timeout) && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
+
 func (c *Client) Connect() error {
 	if token := c.cli.Connect(); token.WaitTimeout(c.cfg.Timeout) && token.Error() != nil {
 		return token.Error()
@@ -110,6 +138,10 @@ func (c *Client) Close() {
 	c.cli.Disconnect(1000)
 }
 
+func (c *Client) IsConnected() bool {
+	return c.cli.IsConnectionOpen()
+}
+
 func (c *Client) SetConnectHandler(h ConnectHandler) {
 	c.externalConnectHandler = h
 }
@@ -1,14 +1,45 @@
 package mqtt
 
 import (
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/forest33/honeybee/business/entity"
 	"github.com/forest33/honeybee/pkg/codec"
 )
 
+// RawMessage is a message with undecoded payload
+type RawMessage struct {
+	Topic     string
+	Payload   []byte
+	QoS       byte
+	Retained  bool
+	Duplicate bool
+	MessageID uint16
+}
+
+func newRawMessage(msg mqtt.Message) *RawMessage {
+	return &RawMessage{
+		Topic:     msg.Topic(),
+		Payload:   msg.Payload(),
+		QoS:       msg.Qos(),
+		Retained:  msg.Retained(),
+		Duplicate: msg.Duplicate(),
+		MessageID: msg.MessageID(),
+	}
+}
+
 type message struct {
-	topic   string
-	payload []byte
-	codec   codec.Codec
-	data    map[string]interface{}
+	topic      string
+	payload    []byte
+	codec      codec.Codec
+	data       map[string]interface{}
+	qos        byte
+	retained   bool
+	duplicate  bool
+	messageID  uint16
+	receivedAt time.Time
 }
 
 func (m *message) Topic() string {
@@ -23,19 +54,49 @@ func (m *message) Data() map[string]interface{} {
 	return m.data
 }
 
-func (c *Client) newMessage(topic string, payload []byte) (*message, error) {
+func (m *message) Retained() bool {
+	return m.retained
+}
+
+func (m *message) QoS() byte {
+	return m.qos
+}
+
+func (m *message) Duplicate() bool {
+	return m.duplicate
+}
+
+func (m *message) MessageID() uint16 {
+	return m.messageID
+}
+
+func (m *message) ReceivedAt() time.Time {
+	return m.receivedAt
+}
+
+// NewMessage decodes the payload of the raw message received by the topic subscription
+func NewMessage(c codec.Codec, topic string, raw *RawMessage) (entity.MQTTMessage, error) {
 	var (
 		data map[string]interface{}
 	)
 
-	if err := c.codec.Unmarshal(payload, &data); err != nil {
+	if err := c.Unmarshal(raw.Payload, &data); err != nil {
 		return nil, err
 	}
 
 	return &message{
-		topic:   topic,
-		payload: payload,
-		codec:   c.codec,
-		data:    data,
+		topic:      topic,
+		payload:    raw.Payload,
+		codec:      c,
+		data:       data,
+		qos:        raw.QoS,
+		retained:   raw.Retained,
+		duplicate:  raw.Duplicate,
+		messageID:  raw.MessageID,
+		receivedAt: time.Now(),
 	}, nil
 }
+
+func (c *Client) newMessage(topic string, raw *RawMessage) (entity.MQTTMessage, error) {
+	return NewMessage(c.codec, topic, raw)
+}
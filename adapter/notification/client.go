@@ -2,15 +2,16 @@ package notification
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"net/url"
-	"strings"
+	"time"
 
 	"github.com/forest33/honeybee/business/entity"
 	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/metrics"
 	"github.com/forest33/honeybee/pkg/scheduler"
-	"github.com/forest33/honeybee/pkg/structs"
 )
 
 type Client struct {
@@ -18,25 +19,50 @@ type Client struct {
 	log      *logger.Logger
 	cfg      *Config
 	sh       Scheduler
-	baseURL  *url.URL
+	limiter  Limiter
+	ntfy     *ntfy
+	backends map[string]Backend
 	workerCh chan *message
 }
 
+// Backend delivers the notification message
+type Backend interface {
+	Send(ctx context.Context, m *entity.NotificationMessage) error
+}
+
 type message struct {
-	ctx context.Context
+	ctx     context.Context
+	backend string
 	*entity.NotificationMessage
 }
 
+// retryMessage is the payload of the scheduler task
+type retryMessage struct {
+	Backend string                      `json:"backend"`
+	Message *entity.NotificationMessage `json:"message"`
+}
+
+const (
+	taskKindNotify = "notification.push"
+)
+
 type Scheduler interface {
 	AddTask(t *scheduler.Task)
+	RegisterHandler(kind string, h scheduler.TaskHandler)
+}
+
+type Limiter interface {
+	Allow(channel, key string, interval time.Duration) (bool, int)
 }
 
-func New(ctx context.Context, cfg *Config, log *logger.Logger, sh Scheduler) (*Client, error) {
+func New(ctx context.Context, cfg *Config, log *logger.Logger, sh Scheduler, limiter Limiter) (*Client, error) {
 	c := &Client{
 		ctx:      ctx,
 		cfg:      cfg,
 		log:      log,
 		sh:       sh,
+		limiter:  limiter,
+		backends: make(map[string]Backend),
 		workerCh: make(chan *message, cfg.PoolSize),
 	}
 
@@ -50,11 +76,45 @@ func New(ctx context.Context, cfg *Config, log *logger.Logger, sh Scheduler) (*C
 }
 
 func (c *Client) init() (err error) {
-	c.baseURL, err = url.Parse(c.cfg.BaseURL)
+	c.ntfy, err = newNtfy(c.ctx, c.cfg, c.log)
 	if err != nil {
 		return
 	}
 
+	if err = c.addBackend(BackendNtfy, c.ntfy); err != nil {
+		return
+	}
+	for _, w := range c.cfg.Webhook {
+		if err = c.addBackend(w.Name, newWebhook(w)); err != nil {
+			return
+		}
+	}
+	for _, s := range c.cfg.SMTP {
+		if err = c.addBackend(s.Name, newSMTP(s)); err != nil {
+			return
+		}
+	}
+	for _, g := range c.cfg.Gotify {
+		if err = c.addBackend(g.Name, newGotify(g)); err != nil {
+			return
+		}
+	}
+	for _, p := range c.cfg.Pushover {
+		if err = c.addBackend(p.Name, newPushover(p)); err != nil {
+			return
+		}
+	}
+
+	if c.sh != nil {
+		c.sh.RegisterHandler(taskKindNotify, func(payload []byte) error {
+			m := &retryMessage{}
+			if err := json.Unmarshal(payload, m); err != nil {
+				return err
+			}
+			return c.send(c.ctx, m.Backend, m.Message)
+		})
+	}
+
 	for range c.cfg.PoolSize {
 		go c.worker()
 	}
@@ -62,6 +122,17 @@ func (c *Client) init() (err error) {
 	return
 }
 
+func (c *Client) addBackend(name string, b Backend) error {
+	if len(name) == 0 {
+		return fmt.Errorf("notification backend name is not specified")
+	}
+	if _, ok := c.backends[name]; ok {
+		return fmt.Errorf("duplicate notification backend %s", name)
+	}
+	c.backends[name] = b
+	return nil
+}
+
 func (c *Client) worker() {
 	for {
 		select {
@@ -71,49 +142,121 @@ func (c *Client) worker() {
 			if !ok {
 				return
 			}
-			if err := c.push(m.ctx, m.NotificationMessage); err != nil {
-				c.log.Error().Err(err).Msg("failed to push notification message")
+			if err := c.send(m.ctx, m.backend, m.NotificationMessage); err != nil {
+				c.log.Error().Err(err).Str("backend", m.backend).Msg("failed to push notification message")
 				if c.sh != nil {
-					c.sh.AddTask(&scheduler.Task{Handler: func() error {
-						return c.push(m.ctx, m.NotificationMessage)
-					}})
+					c.retry(m.backend, m.NotificationMessage)
 				}
 			}
 		}
 	}
 }
 
-func (c *Client) Push(ctx context.Context, m *entity.NotificationMessage) {
-	c.workerCh <- &message{
-		ctx:                 ctx,
-		NotificationMessage: m,
+func (c *Client) retry(backend string, m *entity.NotificationMessage) {
+	payload, err := json.Marshal(&retryMessage{
+		Backend: backend,
+		Message: m,
+	})
+	if err != nil {
+		c.log.Error().Err(err).Msg("failed to encode notification message")
+		return
 	}
+
+	c.sh.AddTask(&scheduler.Task{
+		Sender:   backend,
+		Kind:     taskKindNotify,
+		Payload:  payload,
+		Volatile: m.File != nil, // the content of the attachment is not written to the store
+	})
 }
 
-func (c *Client) push(ctx context.Context, m *entity.NotificationMessage) error {
-	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
-	defer cancel()
+// Push sends the message through the backends listed in the message or through the default backends,
+// the message of the caller is not changed
+func (c *Client) Push(ctx context.Context, m *entity.NotificationMessage) {
+	normalized := *m
+	m = &normalized
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL.JoinPath(m.Topic).String(), strings.NewReader(m.Body))
-	if err != nil {
-		return err
+	if len(m.Priority) == 0 {
+		m.Priority = c.cfg.Priority
+	}
+
+	backends := m.Backends
+	if len(backends) == 0 {
+		backends = c.cfg.Default
+	}
+	if len(backends) == 0 {
+		c.log.Error().Str("topic", m.Topic).Msg("no notification backends")
+		return
+	}
+
+	var err error
+	if m.File, err = m.File.Load(c.cfg.MaxFileSize); err != nil {
+		c.log.Error().Err(err).Msg("failed to load notification attachment")
+		return
 	}
 
-	if len(m.Title) != 0 {
-		req.Header.Set("Title", m.Title)
+	for _, name := range backends {
+		if _, ok := c.backends[name]; !ok {
+			c.log.Error().Str("backend", name).Msg("unknown notification backend")
+			continue
+		}
+		if name == BackendNtfy && len(m.Topic) == 0 {
+			c.log.Error().Str("backend", name).Msg("empty ntfy topic")
+			continue
+		}
+
+		ok, suppressed := c.limiter.Allow(name, m.DedupeKey, m.DedupeInterval)
+		if !ok {
+			c.log.Debug().Str("backend", name).Str("key", m.DedupeKey).Msg("notification suppressed by rate limit")
+			continue
+		}
+
+		msg := m
+		if suppressed > 0 {
+			msg = &entity.NotificationMessage{}
+			*msg = *m
+			msg.Body += fmt.Sprintf("\n\n(%d similar notifications suppressed)", suppressed)
+		}
+
+		c.workerCh <- &message{
+			ctx:                 ctx,
+			backend:             name,
+			NotificationMessage: msg,
+		}
 	}
-	if len(m.Attach) != 0 {
-		req.Header.Set("Attach", m.Attach)
+}
+
+// Subscribe receives messages of the ntfy topic
+func (c *Client) Subscribe(topic string, handler func(m *entity.ReceivedNotification)) {
+	c.ntfy.Subscribe(topic, handler)
+}
+
+func (c *Client) send(ctx context.Context, backend string, m *entity.NotificationMessage) error {
+	b, ok := c.backends[backend]
+	if !ok {
+		return fmt.Errorf("unknown notification backend %s", backend)
 	}
 
-	req.Header.Set("Priority", structs.If(len(m.Priority) != 0, m.Priority, c.cfg.Priority))
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	err := b.Send(ctx, m)
+	metrics.NotificationDeliveries.WithLabelValues(backend, metrics.Result(err)).Inc()
+
+	return err
+}
 
+// do sends the HTTP request, any status other than 2xx is an error
+func do(req *http.Request) error {
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to push notification: status %d", resp.StatusCode)
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
 	}
 
 	return nil
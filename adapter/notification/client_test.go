@@ -0,0 +1,162 @@
+package notification
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/ratelimit"
+	"github.com/forest33/honeybee/pkg/scheduler"
+)
+
+// recordedRequest is the request received by the test server
+type recordedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// recorder is the HTTP server which passes received requests to the channel and replies with the status
+type recorder struct {
+	srv      *httptest.Server
+	status   int
+	requests chan *recordedRequest
+}
+
+func newRecorder(t *testing.T) *recorder {
+	r := &recorder{
+		status:   http.StatusOK,
+		requests: make(chan *recordedRequest, 16),
+	}
+	r.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.requests <- &recordedRequest{
+			method: req.Method,
+			path:   req.URL.Path,
+			header: req.Header,
+			body:   body,
+		}
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+// next returns the next received request
+func (r *recorder) next(t *testing.T) *recordedRequest {
+	t.Helper()
+	select {
+	case req := <-r.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("request is not received")
+		return nil
+	}
+}
+
+// fakeScheduler passes the added tasks to the channel
+type fakeScheduler struct {
+	tasks    chan *scheduler.Task
+	handlers map[string]scheduler.TaskHandler
+	sync.Mutex
+}
+
+func (s *fakeScheduler) AddTask(t *scheduler.Task) {
+	s.tasks <- t
+}
+
+func (s *fakeScheduler) RegisterHandler(kind string, h scheduler.TaskHandler) {
+	s.Lock()
+	defer s.Unlock()
+	s.handlers[kind] = h
+}
+
+func newTestClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	return newTestClientWithScheduler(t, cfg, nil)
+}
+
+func newTestClientWithScheduler(t *testing.T, cfg Config, sh Scheduler) *Client {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg.Timeout = 5 * time.Second
+	cfg.PoolSize = 1
+
+	c, err := New(ctx, &cfg, logger.NewDefault(), sh, ratelimit.New(ratelimit.Config{}))
+	if err != nil {
+		t.Fatalf("failed to create notification client: %v", err)
+	}
+
+	return c
+}
+
+func TestPushDoesNotChangeMessage(t *testing.T) {
+	rec := newRecorder(t)
+	c := newTestClient(t, Config{BaseURL: rec.srv.URL, Priority: "high", Default: []string{BackendNtfy}})
+
+	path := filepath.Join(t.TempDir(), "cam.jpg")
+	if err := os.WriteFile(path, []byte("before"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &entity.Attachment{Path: path}
+	m := &entity.NotificationMessage{Topic: "alerts", Body: "door opened", File: file}
+	c.Push(context.Background(), m)
+
+	if len(m.Priority) != 0 || m.File != file || m.File.Data != nil {
+		t.Errorf("expected the message not to be changed, got %+v", m)
+	}
+
+	// the file is read when the message is pushed
+	if err := os.WriteFile(path, []byte("after"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	req := rec.next(t)
+	if string(req.body) != "before" {
+		t.Errorf("expected the content read by Push, got %q", req.body)
+	}
+	if got := req.header.Get("Priority"); got != "high" {
+		t.Errorf("expected the default priority, got %q", got)
+	}
+}
+
+func TestRetryAttachmentVolatile(t *testing.T) {
+	rec := newRecorder(t)
+	rec.status = http.StatusInternalServerError
+	sh := &fakeScheduler{tasks: make(chan *scheduler.Task, 2), handlers: make(map[string]scheduler.TaskHandler)}
+	c := newTestClientWithScheduler(t, Config{BaseURL: rec.srv.URL, Default: []string{BackendNtfy}}, sh)
+
+	tests := []struct {
+		file     *entity.Attachment
+		volatile bool
+	}{
+		{nil, false},
+		{&entity.Attachment{Name: "cam.jpg", Data: []byte("jpeg")}, true},
+	}
+
+	for _, tt := range tests {
+		c.Push(context.Background(), &entity.NotificationMessage{Topic: "alerts", Body: "door opened", File: tt.file})
+		rec.next(t)
+
+		select {
+		case task := <-sh.tasks:
+			if task.Volatile != tt.volatile {
+				t.Errorf("attachment %v: expected Volatile %v, got %v", tt.file != nil, tt.volatile, task.Volatile)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("retry task is not added")
+		}
+	}
+}
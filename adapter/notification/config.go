@@ -1,10 +1,80 @@
 package notification
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// BackendNtfy is the name of the built-in ntfy backend
+	BackendNtfy = "ntfy"
+)
 
 type Config struct {
-	BaseURL  string
-	Timeout  time.Duration
-	Priority string
-	PoolSize int
+	BaseURL     string
+	Timeout     time.Duration
+	Priority    string
+	PoolSize    int
+	Token       string
+	User        string
+	Password    string
+	MaxFileSize int64
+	Default     []string
+	Webhook     []Webhook
+	SMTP        []SMTP
+	Gotify      []Gotify
+	Pushover    []Pushover
+}
+
+// Webhook posts the message as JSON to the URL
+type Webhook struct {
+	Name    string
+	URL     string
+	Method  string
+	Headers map[string]string
+}
+
+// SMTP sends the message by e-mail, TLS is used for the implicit TLS connection (port 465),
+// otherwise STARTTLS is used if the server supports it
+type SMTP struct {
+	Name     string
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+	To       []string
+	TLS      bool
+}
+
+type Gotify struct {
+	Name  string
+	URL   string
+	Token string
+}
+
+type Pushover struct {
+	Name   string
+	URL    string
+	Token  string
+	User   string
+	Device string
+}
+
+// priorityLevel converts the ntfy priority (min, low, default, high, max/urgent or 1-5) to the number from 1 to 5
+func priorityLevel(p string) int {
+	switch p {
+	case "min":
+		return 1
+	case "low":
+		return 2
+	case "high":
+		return 4
+	case "max", "urgent":
+		return 5
+	}
+	if v, err := strconv.Atoi(p); err == nil && v >= 1 && v <= 5 {
+		return v
+	}
+	return 3
 }
@@ -0,0 +1,58 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// gotify sends the message to the Gotify server, https://gotify.net/docs/pushmsg
+type gotify struct {
+	cfg Gotify
+}
+
+type gotifyPayload struct {
+	Title    string                 `json:"title,omitempty"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+func newGotify(cfg Gotify) *gotify {
+	return &gotify{cfg: cfg}
+}
+
+func (g *gotify) Send(ctx context.Context, m *entity.NotificationMessage) error {
+	payload := &gotifyPayload{
+		Title:   m.Title,
+		Message: m.Body,
+		// Gotify priorities are from 0 to 10
+		Priority: priorityLevel(m.Priority) * 2,
+		Extras:   make(map[string]interface{}),
+	}
+	if m.Markdown {
+		payload.Extras["client::display"] = map[string]string{"contentType": "text/markdown"}
+	}
+	if len(m.Click) != 0 {
+		payload.Extras["client::notification"] = map[string]interface{}{"click": map[string]string{"url": m.Click}}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(g.cfg.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.cfg.Token)
+
+	return do(req)
+}
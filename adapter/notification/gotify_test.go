@@ -0,0 +1,83 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+func TestGotifySend(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     *entity.NotificationMessage
+		payload map[string]any
+	}{
+		{
+			name:    "plain",
+			msg:     &entity.NotificationMessage{Body: "door opened"},
+			payload: map[string]any{"message": "door opened", "priority": 6.0},
+		},
+		{
+			name: "markdown and click",
+			msg: &entity.NotificationMessage{
+				Title:    "Door",
+				Body:     "**door** opened",
+				Priority: "max",
+				Markdown: true,
+				Click:    "https://home.example.com/door",
+			},
+			payload: map[string]any{
+				"title":    "Door",
+				"message":  "**door** opened",
+				"priority": 10.0,
+				"extras": map[string]any{
+					"client::display":      map[string]any{"contentType": "text/markdown"},
+					"client::notification": map[string]any{"click": map[string]any{"url": "https://home.example.com/door"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newRecorder(t)
+			g := newGotify(Gotify{Name: "gotify", URL: rec.srv.URL + "/", Token: "app_token"})
+
+			if err := g.Send(context.Background(), tt.msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := rec.next(t)
+			if req.method != http.MethodPost || req.path != "/message" {
+				t.Errorf("expected POST /message, got %s %s", req.method, req.path)
+			}
+			if got := req.header.Get("X-Gotify-Key"); got != "app_token" {
+				t.Errorf("expected the application token, got %q", got)
+			}
+
+			var payload map[string]any
+			if err := json.Unmarshal(req.body, &payload); err != nil {
+				t.Fatalf("failed to decode payload %s: %v", req.body, err)
+			}
+			if !reflect.DeepEqual(payload, tt.payload) {
+				t.Errorf("expected payload %v, got %v", tt.payload, payload)
+			}
+		})
+	}
+}
+
+func TestGotifyError(t *testing.T) {
+	rec := newRecorder(t)
+	rec.status = http.StatusUnauthorized
+	g := newGotify(Gotify{Name: "gotify", URL: rec.srv.URL, Token: "wrong"})
+
+	err := g.Send(context.Background(), &entity.NotificationMessage{Body: "door opened"})
+	if err == nil || !strings.HasPrefix(err.Error(), "status 401") {
+		t.Errorf("expected status 401 error, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+// ntfy publishes messages to the ntfy server, https://docs.ntfy.sh/publish/
+type ntfy struct {
+	ctx     context.Context
+	log     *logger.Logger
+	cfg     *Config
+	baseURL *url.URL
+}
+
+func newNtfy(ctx context.Context, cfg *Config, log *logger.Logger) (*ntfy, error) {
+	baseURL, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ntfy{
+		ctx:     ctx,
+		log:     log,
+		cfg:     cfg,
+		baseURL: baseURL,
+	}, nil
+}
+
+func (n *ntfy) Send(ctx context.Context, m *entity.NotificationMessage) error {
+	req, err := n.request(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	setHeader(req, "Title", m.Title)
+	setHeader(req, "Attach", m.Attach)
+	setHeader(req, "Tags", strings.Join(m.Tags, ","))
+	setHeader(req, "Click", m.Click)
+	setHeader(req, "Icon", m.Icon)
+	setHeader(req, "Delay", m.Delay)
+	setHeader(req, "Email", m.Email)
+	setHeader(req, "Actions", actionsHeader(m.Actions))
+	setHeader(req, "Priority", m.Priority)
+	if m.Markdown {
+		req.Header.Set("Markdown", "yes")
+	}
+
+	n.setAuth(req)
+
+	return do(req)
+}
+
+// request creates the request which publishes the message, the attachment is uploaded as the request body
+// and the message is passed in the header, https://docs.ntfy.sh/publish/#attach-local-file
+func (n *ntfy) request(ctx context.Context, m *entity.NotificationMessage) (*http.Request, error) {
+	topicURL := n.baseURL.JoinPath(m.Topic).String()
+
+	if m.File == nil {
+		return http.NewRequestWithContext(ctx, http.MethodPost, topicURL, strings.NewReader(m.Body))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, topicURL, bytes.NewReader(m.File.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	setHeader(req, "Filename", m.File.FileName())
+	// header values can't contain line breaks, ntfy converts \n back to them
+	setHeader(req, "Message", strings.ReplaceAll(m.Body, "\n", `\n`))
+
+	return req, nil
+}
+
+// setAuth sets the access token or the basic auth credentials from config
+func (n *ntfy) setAuth(req *http.Request) {
+	if len(n.cfg.Token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+n.cfg.Token)
+	} else if len(n.cfg.User) != 0 {
+		req.SetBasicAuth(n.cfg.User, n.cfg.Password)
+	}
+}
+
+func setHeader(req *http.Request, key, value string) {
+	if len(value) != 0 {
+		req.Header.Set(key, value)
+	}
+}
+
+// actionsHeader formats action buttons in the ntfy short format:
+// "view, Open, https://example.com, clear=true; http, Close, https://example.com/api, method=PUT"
+func actionsHeader(actions []*entity.NotificationAction) string {
+	items := make([]string, 0, len(actions))
+	for _, a := range actions {
+		fields := []string{a.Action, quote(a.Label)}
+		if len(a.URL) != 0 {
+			fields = append(fields, quote(a.URL))
+		}
+		if a.Clear {
+			fields = append(fields, "clear=true")
+		}
+		if len(a.Method) != 0 {
+			fields = append(fields, "method="+quote(a.Method))
+		}
+		for _, k := range slices.Sorted(maps.Keys(a.Headers)) {
+			fields = append(fields, "headers."+k+"="+quote(a.Headers[k]))
+		}
+		if len(a.Body) != 0 {
+			fields = append(fields, "body="+quote(a.Body))
+		}
+		if len(a.Intent) != 0 {
+			fields = append(fields, "intent="+quote(a.Intent))
+		}
+		for _, k := range slices.Sorted(maps.Keys(a.Extras)) {
+			fields = append(fields, "extras."+k+"="+quote(a.Extras[k]))
+		}
+		items = append(items, strings.Join(fields, ", "))
+	}
+	return strings.Join(items, "; ")
+}
+
+// quote quotes the action field value if it contains separators
+func quote(v string) string {
+	if !strings.ContainsAny(v, ",;=\"'") {
+		return v
+	}
+	if strings.Contains(v, "\"") {
+		return "'" + v + "'"
+	}
+	return "\"" + v + "\""
+}
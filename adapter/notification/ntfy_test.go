@@ -0,0 +1,179 @@
+package notification
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// ntfyHeaders are the headers which are checked in every test case, absent headers must be empty
+var ntfyHeaders = []string{
+	"Title", "Attach", "Tags", "Click", "Icon", "Delay", "Email", "Actions", "Priority", "Markdown",
+	"Authorization", "Filename", "Message",
+}
+
+func TestNtfyPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		msg     *entity.NotificationMessage
+		method  string
+		headers map[string]string
+		body    string
+	}{
+		{
+			name:    "default priority",
+			cfg:     Config{Priority: "high"},
+			msg:     &entity.NotificationMessage{Body: "door opened"},
+			headers: map[string]string{"Priority": "high"},
+		},
+		{
+			name:    "title and priority",
+			cfg:     Config{Priority: "high"},
+			msg:     &entity.NotificationMessage{Title: "Door", Body: "door opened", Priority: "min"},
+			headers: map[string]string{"Title": "Door", "Priority": "min"},
+		},
+		{
+			name:    "tags",
+			msg:     &entity.NotificationMessage{Body: "door opened", Tags: []string{"warning", "door"}},
+			headers: map[string]string{"Tags": "warning,door"},
+		},
+		{
+			name:    "click",
+			msg:     &entity.NotificationMessage{Body: "door opened", Click: "https://home.example.com/door"},
+			headers: map[string]string{"Click": "https://home.example.com/door"},
+		},
+		{
+			name: "actions",
+			msg: &entity.NotificationMessage{
+				Body: "door opened",
+				Actions: []*entity.NotificationAction{
+					{Action: "view", Label: "Open camera", URL: "https://home.example.com/cam", Clear: true},
+					{
+						Action:  "http",
+						Label:   "Close, please",
+						URL:     "https://home.example.com/api?door=close",
+						Method:  "PUT",
+						Headers: map[string]string{"X-Token": "abc", "Content-Type": "application/json"},
+						Body:    `{"door":"close"}`,
+					},
+					{Action: "broadcast", Label: "Silence", Intent: "io.heckel.ntfy.USER_ACTION", Extras: map[string]string{"cmd": "mute"}},
+				},
+			},
+			headers: map[string]string{
+				"Actions": `view, Open camera, https://home.example.com/cam, clear=true; ` +
+					`http, "Close, please", "https://home.example.com/api?door=close", method=PUT, ` +
+					`headers.Content-Type=application/json, headers.X-Token=abc, body='{"door":"close"}'; ` +
+					`broadcast, Silence, intent=io.heckel.ntfy.USER_ACTION, extras.cmd=mute`,
+			},
+		},
+		{
+			name:    "icon",
+			msg:     &entity.NotificationMessage{Body: "door opened", Icon: "https://home.example.com/door.png"},
+			headers: map[string]string{"Icon": "https://home.example.com/door.png"},
+		},
+		{
+			name:    "delay",
+			msg:     &entity.NotificationMessage{Body: "door opened", Delay: "30m"},
+			headers: map[string]string{"Delay": "30m"},
+		},
+		{
+			name:    "email",
+			msg:     &entity.NotificationMessage{Body: "door opened", Email: "me@example.com"},
+			headers: map[string]string{"Email": "me@example.com"},
+		},
+		{
+			name:    "markdown",
+			msg:     &entity.NotificationMessage{Body: "**door** opened", Markdown: true},
+			headers: map[string]string{"Markdown": "yes"},
+		},
+		{
+			name:    "attach url",
+			msg:     &entity.NotificationMessage{Body: "door opened", Attach: "https://home.example.com/cam.jpg"},
+			headers: map[string]string{"Attach": "https://home.example.com/cam.jpg"},
+		},
+		{
+			name:    "token auth",
+			cfg:     Config{Token: "tk_secret", User: "ignored", Password: "ignored"},
+			msg:     &entity.NotificationMessage{Body: "door opened"},
+			headers: map[string]string{"Authorization": "Bearer tk_secret"},
+		},
+		{
+			name:    "basic auth",
+			cfg:     Config{User: "bee", Password: "honey"},
+			msg:     &entity.NotificationMessage{Body: "door opened"},
+			headers: map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("bee:honey"))},
+		},
+		{
+			name: "file upload",
+			msg: &entity.NotificationMessage{
+				Title: "Door",
+				Body:  "door opened\nby the cat",
+				File:  &entity.Attachment{Name: "cam.jpg", Data: []byte("jpeg data")},
+			},
+			method:  http.MethodPut,
+			headers: map[string]string{"Title": "Door", "Filename": "cam.jpg", "Message": `door opened\nby the cat`},
+			body:    "jpeg data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newRecorder(t)
+			tt.cfg.BaseURL = rec.srv.URL
+			tt.cfg.Default = []string{BackendNtfy}
+			c := newTestClient(t, tt.cfg)
+
+			tt.msg.Topic = "alerts"
+			c.Push(context.Background(), tt.msg)
+			req := rec.next(t)
+
+			method := tt.method
+			if len(method) == 0 {
+				method = http.MethodPost
+			}
+			if req.method != method {
+				t.Errorf("expected method %s, got %s", method, req.method)
+			}
+			if req.path != "/alerts" {
+				t.Errorf("expected path /alerts, got %s", req.path)
+			}
+
+			body := tt.body
+			if tt.msg.File == nil {
+				body = tt.msg.Body
+			}
+			if string(req.body) != body {
+				t.Errorf("expected body %q, got %q", body, req.body)
+			}
+
+			for _, h := range ntfyHeaders {
+				if got := req.header.Get(h); got != tt.headers[h] {
+					t.Errorf("expected header %s %q, got %q", h, tt.headers[h], got)
+				}
+			}
+		})
+	}
+}
+
+func TestNtfyError(t *testing.T) {
+	rec := newRecorder(t)
+	rec.status = http.StatusForbidden
+
+	n, err := newNtfy(context.Background(), &Config{BaseURL: rec.srv.URL + "/ntfy/"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = n.Send(context.Background(), &entity.NotificationMessage{Topic: "alerts", Body: "door opened"})
+	if err == nil || !strings.HasPrefix(err.Error(), "status 403") {
+		t.Errorf("expected status 403 error, got %v", err)
+	}
+	if req := rec.next(t); req.path != "/ntfy/alerts" {
+		t.Errorf("expected path /ntfy/alerts, got %s", req.path)
+	}
+}
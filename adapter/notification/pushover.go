@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// pushover sends the message through the Pushover API, https://pushover.net/api
+type pushover struct {
+	cfg Pushover
+}
+
+func newPushover(cfg Pushover) *pushover {
+	return &pushover{cfg: cfg}
+}
+
+func (p *pushover) Send(ctx context.Context, m *entity.NotificationMessage) error {
+	form := url.Values{}
+	form.Set("token", p.cfg.Token)
+	form.Set("user", p.cfg.User)
+	form.Set("message", m.Body)
+	// Pushover priorities are from -2 to 2, the emergency priority 2 requires acknowledgement, so it is not used
+	form.Set("priority", strconv.Itoa(min(priorityLevel(m.Priority)-3, 1)))
+	if len(m.Title) != 0 {
+		form.Set("title", m.Title)
+	}
+	if len(m.Click) != 0 {
+		form.Set("url", m.Click)
+	}
+	if len(p.cfg.Device) != 0 {
+		form.Set("device", p.cfg.Device)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return do(req)
+}
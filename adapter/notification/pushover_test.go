@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+func TestPushoverSend(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Pushover
+		msg    *entity.NotificationMessage
+		fields url.Values
+	}{
+		{
+			name: "plain",
+			msg:  &entity.NotificationMessage{Body: "door opened"},
+			fields: url.Values{
+				"token":    {"app_token"},
+				"user":     {"user_key"},
+				"message":  {"door opened"},
+				"priority": {"0"},
+			},
+		},
+		{
+			name: "title, click and device",
+			cfg:  Pushover{Device: "phone"},
+			msg:  &entity.NotificationMessage{Title: "Door", Body: "door opened", Click: "https://home.example.com/door", Priority: "min"},
+			fields: url.Values{
+				"token":    {"app_token"},
+				"user":     {"user_key"},
+				"message":  {"door opened"},
+				"priority": {"-2"},
+				"title":    {"Door"},
+				"url":      {"https://home.example.com/door"},
+				"device":   {"phone"},
+			},
+		},
+		{
+			// the emergency priority is not used
+			name: "max priority",
+			msg:  &entity.NotificationMessage{Body: "door opened", Priority: "urgent"},
+			fields: url.Values{
+				"token":    {"app_token"},
+				"user":     {"user_key"},
+				"message":  {"door opened"},
+				"priority": {"1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newRecorder(t)
+			tt.cfg.Name, tt.cfg.URL, tt.cfg.Token, tt.cfg.User = "pushover", rec.srv.URL+"/1/messages.json", "app_token", "user_key"
+			p := newPushover(tt.cfg)
+
+			if err := p.Send(context.Background(), tt.msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := rec.next(t)
+			if req.method != http.MethodPost || req.path != "/1/messages.json" {
+				t.Errorf("expected POST /1/messages.json, got %s %s", req.method, req.path)
+			}
+			if got := req.header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+				t.Errorf("expected form content type, got %q", got)
+			}
+
+			fields, err := url.ParseQuery(string(req.body))
+			if err != nil {
+				t.Fatalf("failed to decode form %s: %v", req.body, err)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected fields %v, got %v", tt.fields, fields)
+			}
+		})
+	}
+}
+
+func TestPushoverError(t *testing.T) {
+	rec := newRecorder(t)
+	rec.status = http.StatusBadRequest
+	p := newPushover(Pushover{Name: "pushover", URL: rec.srv.URL, Token: "app_token", User: "wrong"})
+
+	err := p.Send(context.Background(), &entity.NotificationMessage{Body: "door opened"})
+	if err == nil || !strings.HasPrefix(err.Error(), "status 400") {
+		t.Errorf("expected status 400 error, got %v", err)
+	}
+}
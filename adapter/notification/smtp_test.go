@@ -0,0 +1,186 @@
+package notification
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// fakeSMTP is the SMTP server which accepts one session and records its commands and the message
+type fakeSMTP struct {
+	ln         net.Listener
+	rejectRcpt string
+	commands   []string
+	data       string
+	done       chan struct{}
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	return &fakeSMTP{ln: ln, done: make(chan struct{})}
+}
+
+func (s *fakeSMTP) serve() {
+	defer close(s.done)
+
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		s.commands = append(s.commands, line)
+
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost")
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			_ = tp.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			if len(s.rejectRcpt) != 0 && strings.Contains(line, s.rejectRcpt) {
+				_ = tp.PrintfLine("550 No such user")
+			} else {
+				_ = tp.PrintfLine("250 OK")
+			}
+		case "DATA":
+			_ = tp.PrintfLine("354 Start mail input")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			_ = tp.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) config() SMTP {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return SMTP{
+		Name: "mail",
+		Host: addr.IP.String(),
+		Port: addr.Port,
+		From: "honeybee@example.com",
+		To:   []string{"me@example.com", "you@example.com"},
+	}
+}
+
+// send sends the message to the fake server and waits for the end of the session
+func (s *fakeSMTP) send(t *testing.T, cfg SMTP, m *entity.NotificationMessage) error {
+	t.Helper()
+
+	go s.serve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := newSMTP(cfg).Send(ctx, m)
+
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP session is not finished")
+	}
+
+	return err
+}
+
+func TestSMTPSend(t *testing.T) {
+	srv := newFakeSMTP(t)
+	cfg := srv.config()
+	cfg.User, cfg.Password = "bee", "honey"
+
+	err := srv.send(t, cfg, &entity.NotificationMessage{
+		Topic:    "alerts",
+		Title:    "Door",
+		Body:     "door opened\nby the cat",
+		Priority: "high",
+		Click:    "https://home.example.com/door",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00bee\x00honey"))
+	for _, cmd := range []string{auth, "MAIL FROM:<honeybee@example.com>", "RCPT TO:<me@example.com>", "RCPT TO:<you@example.com>", "QUIT"} {
+		if !slices.Contains(srv.commands, cmd) {
+			t.Errorf("expected command %q, got %q", cmd, srv.commands)
+		}
+	}
+
+	for _, line := range []string{
+		"From: honeybee@example.com\n",
+		"To: me@example.com, you@example.com\n",
+		"Subject: Door\n",
+		"X-Priority: 1\n",
+		"Content-Type: text/plain; charset=utf-8\n",
+		"\n\ndoor opened\nby the cat\n\nhttps://home.example.com/door\n",
+	} {
+		if !strings.Contains(srv.data, line) {
+			t.Errorf("expected message to contain %q, got %q", line, srv.data)
+		}
+	}
+}
+
+func TestSMTPSendDefaults(t *testing.T) {
+	srv := newFakeSMTP(t)
+
+	err := srv.send(t, srv.config(), &entity.NotificationMessage{Topic: "тревога", Body: "door opened", Priority: "low"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, cmd := range srv.commands {
+		if strings.HasPrefix(cmd, "AUTH") {
+			t.Errorf("expected no authentication without the user, got %q", cmd)
+		}
+	}
+	// the topic is the subject of the message without the title
+	if !strings.Contains(srv.data, "Subject: =?utf-8?q?") {
+		t.Errorf("expected the encoded subject, got %q", srv.data)
+	}
+	if strings.Contains(srv.data, "X-Priority") {
+		t.Errorf("expected no X-Priority for the low priority, got %q", srv.data)
+	}
+}
+
+func TestSMTPRejectedRecipient(t *testing.T) {
+	srv := newFakeSMTP(t)
+	srv.rejectRcpt = "you@example.com"
+
+	err := srv.send(t, srv.config(), &entity.NotificationMessage{Title: "Door", Body: "door opened"})
+	if err == nil || !strings.Contains(err.Error(), "No such user") {
+		t.Errorf("expected rejected recipient error, got %v", err)
+	}
+	if len(srv.data) != 0 {
+		t.Errorf("expected no message to be sent, got %q", srv.data)
+	}
+}
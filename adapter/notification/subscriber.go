@@ -0,0 +1,111 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+const (
+	eventMessage          = "message"
+	reconnectDelay        = time.Second
+	maxReconnectDelay     = time.Minute
+	keepaliveTimeout      = 2 * time.Minute
+	maxStreamMessageBytes = 1024 * 1024
+)
+
+// Subscribe starts receiving messages of the topic through the ntfy JSON stream,
+// the stream is reconnected on errors and the missed messages are requested from the server
+func (n *ntfy) Subscribe(topic string, handler func(m *entity.ReceivedNotification)) {
+	go func() {
+		var since string
+		delay := reconnectDelay
+
+		for {
+			connected, err := n.stream(topic, &since, handler)
+			if n.ctx.Err() != nil {
+				return
+			}
+			if connected {
+				delay = reconnectDelay
+			}
+
+			n.log.Error().Err(err).Str("topic", topic).Dur("delay", delay).Msg("notification stream closed, reconnecting")
+
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			delay = min(delay*2, maxReconnectDelay)
+		}
+	}()
+}
+
+// stream reads messages until the stream is closed, since holds the id of the last received message
+func (n *ntfy) stream(topic string, since *string, handler func(m *entity.ReceivedNotification)) (bool, error) {
+	ctx, cancel := context.WithCancel(n.ctx)
+	defer cancel()
+
+	// the server sends keepalive events, the stream is considered broken if nothing is received
+	watchdog := time.AfterFunc(keepaliveTimeout, cancel)
+	defer watchdog.Stop()
+
+	u := n.baseURL.JoinPath(topic, "json")
+	if len(*since) != 0 {
+		q := u.Query()
+		q.Set("since", *since)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	n.setAuth(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to subscribe to notification topic: status %d", resp.StatusCode)
+	}
+
+	n.log.Info().Str("topic", topic).Msg("subscribed to notification topic")
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxStreamMessageBytes)
+
+	for scanner.Scan() {
+		watchdog.Reset(keepaliveTimeout)
+
+		m := &entity.ReceivedNotification{}
+		if err := json.Unmarshal(scanner.Bytes(), m); err != nil {
+			n.log.Error().Err(err).Str("topic", topic).Msg("failed to decode notification stream event")
+			continue
+		}
+		if m.Event != eventMessage {
+			continue
+		}
+
+		*since = m.ID
+		handler(m)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+
+	return true, errors.New("stream closed by server")
+}
@@ -0,0 +1,60 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// webhook posts the message as JSON to the URL
+type webhook struct {
+	cfg Webhook
+}
+
+type webhookPayload struct {
+	Topic    string   `json:"topic,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+	Icon     string   `json:"icon,omitempty"`
+	Attach   string   `json:"attach,omitempty"`
+	Markdown bool     `json:"markdown,omitempty"`
+}
+
+func newWebhook(cfg Webhook) *webhook {
+	return &webhook{cfg: cfg}
+}
+
+func (w *webhook) Send(ctx context.Context, m *entity.NotificationMessage) error {
+	body, err := json.Marshal(&webhookPayload{
+		Topic:    m.Topic,
+		Title:    m.Title,
+		Message:  m.Body,
+		Priority: priorityLevel(m.Priority),
+		Tags:     m.Tags,
+		Click:    m.Click,
+		Icon:     m.Icon,
+		Attach:   m.Attach,
+		Markdown: m.Markdown,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.cfg.Method, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return do(req)
+}
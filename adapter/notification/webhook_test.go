@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+func TestWebhookSend(t *testing.T) {
+	rec := newRecorder(t)
+	w := newWebhook(Webhook{
+		Name:    "hook",
+		URL:     rec.srv.URL + "/hooks/door",
+		Method:  http.MethodPut,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+
+	err := w.Send(context.Background(), &entity.NotificationMessage{
+		Topic:    "alerts",
+		Title:    "Door",
+		Body:     "door opened",
+		Priority: "high",
+		Tags:     []string{"warning"},
+		Click:    "https://home.example.com/door",
+		Icon:     "https://home.example.com/door.png",
+		Attach:   "https://home.example.com/cam.jpg",
+		Markdown: true,
+		Delay:    "30m", // not supported by the webhook
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := rec.next(t)
+	if req.method != http.MethodPut || req.path != "/hooks/door" {
+		t.Errorf("expected PUT /hooks/door, got %s %s", req.method, req.path)
+	}
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected JSON content type, got %q", got)
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("expected the configured Authorization header, got %q", got)
+	}
+
+	payload := &webhookPayload{}
+	if err := json.Unmarshal(req.body, payload); err != nil {
+		t.Fatalf("failed to decode payload %s: %v", req.body, err)
+	}
+	want := &webhookPayload{
+		Topic:    "alerts",
+		Title:    "Door",
+		Message:  "door opened",
+		Priority: 4,
+		Tags:     []string{"warning"},
+		Click:    "https://home.example.com/door",
+		Icon:     "https://home.example.com/door.png",
+		Attach:   "https://home.example.com/cam.jpg",
+		Markdown: true,
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("expected payload %+v, got %+v", want, payload)
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	rec := newRecorder(t)
+	rec.status = http.StatusInternalServerError
+	w := newWebhook(Webhook{Name: "hook", URL: rec.srv.URL, Method: http.MethodPost})
+
+	err := w.Send(context.Background(), &entity.NotificationMessage{Body: "door opened"})
+	if err == nil || !strings.HasPrefix(err.Error(), "status 500") {
+		t.Errorf("expected status 500 error, got %v", err)
+	}
+}
+
+func TestPushBackends(t *testing.T) {
+	ntfy, hook := newRecorder(t), newRecorder(t)
+	c := newTestClient(t, Config{
+		BaseURL: ntfy.srv.URL,
+		Default: []string{BackendNtfy},
+		Webhook: []Webhook{{Name: "hook", URL: hook.srv.URL, Method: http.MethodPost}},
+	})
+
+	c.Push(context.Background(), &entity.NotificationMessage{Body: "to webhook", Backends: []string{"hook"}})
+	if req := hook.next(t); !strings.Contains(string(req.body), `"message":"to webhook"`) {
+		t.Errorf("expected the message sent to the webhook, got %s", req.body)
+	}
+
+	c.Push(context.Background(), &entity.NotificationMessage{Topic: "alerts", Body: "to default"})
+	if req := ntfy.next(t); string(req.body) != "to default" {
+		t.Errorf("expected the message sent to ntfy, got %s", req.body)
+	}
+
+	if len(ntfy.requests) != 0 || len(hook.requests) != 0 {
+		t.Error("expected every message to be sent through its backends only")
+	}
+}
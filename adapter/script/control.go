@@ -0,0 +1,137 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	gluajson "github.com/layeh/gopher-json"
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+
+	"github.com/forest33/honeybee/adapter/mqtt"
+	"github.com/forest33/honeybee/pkg/codec"
+)
+
+var (
+	ErrScriptNotLoaded = errors.New("script is not loaded")
+	ErrScriptUnloaded  = errors.New("script is unloaded")
+)
+
+// CallFunction calls the global function of the loaded script in the script context,
+// the arguments and the returned values are JSON arrays
+func (s *Script) CallFunction(ctx context.Context, name, fn string, args []byte) ([]byte, error) {
+	sc, err := s.loadedScript(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var params []interface{}
+	if len(args) != 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return nil, fmt.Errorf("arguments must be a JSON array: %w", err)
+		}
+	}
+
+	var result []json.RawMessage
+	err = s.run(ctx, sc, func(done func(err error)) {
+		f := sc.state.GetGlobal(fn)
+		if f.Type() != lua.LTFunction {
+			done(fmt.Errorf("function %s not found", fn))
+			return
+		}
+
+		values := make([]lua.LValue, 0, len(params))
+		for _, p := range params {
+			values = append(values, gluajson.DecodeValue(sc.state, p))
+		}
+
+		sc.invoke(f, func(ret []lua.LValue, err error) {
+			if err != nil {
+				done(luaError(err))
+				return
+			}
+
+			encoded := make([]json.RawMessage, 0, len(ret))
+			for _, v := range ret {
+				data, err := gluajson.Encode(v)
+				if err != nil {
+					done(err)
+					return
+				}
+				encoded = append(encoded, data)
+			}
+			result = encoded
+
+			done(nil)
+		}, values...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Str("script", sc.path).Str("function", fn).Msg("script function called")
+
+	return json.Marshal(result)
+}
+
+// InjectMessage passes the MQTT message to OnMessage of the loaded script as if it was received from the broker,
+// the script doesn't have to be subscribed to the topic
+func (s *Script) InjectMessage(ctx context.Context, name, topic string, payload []byte, retained bool) error {
+	sc, err := s.loadedScript(name)
+	if err != nil {
+		return err
+	}
+
+	m, err := mqtt.NewMessage(codec.NewFastJsonCodec(), topic, &mqtt.RawMessage{
+		Topic:    topic,
+		Payload:  payload,
+		Retained: retained,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	s.log.Info().Str("script", sc.path).Str("topic", topic).Msg("injecting message")
+
+	return s.run(ctx, sc, func(done func(err error)) {
+		fn := sc.state.GetGlobal(scriptFuncOnMessage)
+		if fn.Type() != lua.LTFunction {
+			done(fmt.Errorf("function %s not found", scriptFuncOnMessage))
+			return
+		}
+		sc.invoke(fn, func(_ []lua.LValue, err error) {
+			done(luaError(err))
+		}, lua.LString(m.Topic()), luar.New(sc.state, m.Data()), newMessageMeta(sc.state, m))
+	})
+}
+
+// loadedScript returns the loaded script by the name
+func (s *Script) loadedScript(name string) (*script, error) {
+	path, ok := s.findScript(name)
+	if !ok {
+		return nil, ErrScriptNotFound
+	}
+	sc, ok := s.scripts.Load(path)
+	if !ok {
+		return nil, ErrScriptNotLoaded
+	}
+	return sc.(*script), nil
+}
+
+// run queues the function to the script events and waits until it calls done,
+// the function may finish later than the event if the script waits
+func (s *Script) run(ctx context.Context, sc *script, f func(done func(err error))) error {
+	done := make(chan error, 1)
+	sc.call(func() { f(func(err error) { done <- err }) })
+
+	select {
+	case err := <-done:
+		return err
+	case <-sc.ctx.Done():
+		return ErrScriptUnloaded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -80,28 +80,25 @@ func (s *Script) createFnNewAlarm(sc *script) func(L *lua.LState) int {
 					s.log.Debug().Str("script", sc.path).Str("name", name).Msg("alarm finished")
 					return
 				case <-a.t.C:
-					fn := L.GetGlobal(scriptFuncOnAlarm)
-					if fn == lua.LNil || fn == nil || sc.state == nil {
-						s.log.Warn().Str("script", sc.path).Msg("OnAlarm function not found, resetting timer")
-						if err := a.reset(); err != nil {
-							s.log.Error().Str("script", sc.path).
-								Str("name", name).
-								Msg("failed to reset alarm")
-						}
-						return
-					}
-
 					s.log.Debug().
 						Str("script", sc.path).
 						Str("name", name).
 						Msg("running alarm")
 
-					if err := L.CallByParam(lua.P{
-						Fn:   fn,
-						NRet: 0,
-					}, lua.LString(name), data); err != nil {
-						s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnAlarm function")
-					}
+					sc.call(func() {
+						fn := sc.state.GetGlobal(scriptFuncOnAlarm)
+						if fn == lua.LNil || fn == nil || sc.state == nil {
+							s.log.Warn().Str("script", sc.path).Msg("OnAlarm function not found, resetting timer")
+							sc.deleteAlarm(name)
+							return
+						}
+						sc.invoke(fn, func(_ []lua.LValue, err error) {
+							if err != nil {
+								s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnAlarm function")
+								sc.fail(scriptFuncOnAlarm, err)
+							}
+						}, lua.LString(name), data)
+					})
 
 					if err := a.reset(); err != nil {
 						s.log.Error().Str("script", sc.path).
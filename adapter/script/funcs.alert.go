@@ -0,0 +1,66 @@
+package script
+
+import (
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// createFnAlert hb.alert(channel, {title = "...", body = "...", ...}) sends the alert to the channel
+// and returns the alert id for hb.ack or nil and the error
+func (s *Script) createFnAlert(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		channel := L.ToString(1)
+		opts := L.ToTable(2)
+
+		if s.alert == nil {
+			s.log.Error().Str("script", sc.path).Msg("alerts are not initialized")
+			L.Push(lua.LNil)
+			L.Push(lua.LString("alerts are not initialized"))
+			return 2
+		}
+		if len(channel) == 0 || opts == nil {
+			s.log.Error().Str("script", sc.path).Str("channel", channel).Msg("alert incorrect arguments")
+			L.Push(lua.LNil)
+			L.Push(lua.LString("incorrect arguments"))
+			return 2
+		}
+
+		m := &entity.NotificationMessage{}
+		if err := notificationMessage(opts, m); err != nil {
+			s.log.Error().Err(err).Str("script", sc.path).Str("channel", channel).Msg("invalid alert options")
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		id, err := s.alert.Alert(sc.ctx, channel, m)
+		if err != nil {
+			s.log.Error().Err(err).Str("script", sc.path).Str("channel", channel).Msg("failed to send alert")
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		L.Push(lua.LString(id))
+
+		return 1
+	}
+}
+
+// createFnAck hb.ack(id) acknowledges the alert, returns false if the alert is not pending
+func (s *Script) createFnAck(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		id := L.ToString(1)
+
+		if s.alert == nil || len(id) == 0 {
+			s.log.Error().Str("script", sc.path).Str("id", id).Msg("ack incorrect arguments")
+			L.Push(lua.LFalse)
+			return 1
+		}
+
+		L.Push(lua.LBool(s.alert.Ack(id)))
+
+		return 1
+	}
+}
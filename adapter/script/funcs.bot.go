@@ -0,0 +1,213 @@
+package script
+
+import (
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// createFnEditMessage hb.editMessage(chat_id, message_id, text, {parse_mode = "HTML", keyboard = {...}}) replaces the text of the sent message,
+// the inline keyboard is removed unless it is specified
+func (s *Script) createFnEditMessage(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		chatID := L.ToInt64(1)
+		messageID := L.ToInt(2)
+		text := L.ToString(3)
+		opts := L.ToTable(4)
+
+		if s.bot == nil {
+			s.log.Error().Str("script", sc.path).Msg("bot is not initialized")
+			return 0
+		}
+		if chatID == 0 || messageID == 0 || len(text) == 0 {
+			s.log.Error().Str("script", sc.path).Msg("editMessage incorrect arguments")
+			L.Push(lua.LFalse)
+			return 1
+		}
+
+		m := &entity.BotMessage{Text: text}
+		if opts != nil {
+			m.ParseMode = lua.LVAsString(opts.RawGetString("parse_mode"))
+			m.Keyboard = keyboard(opts.RawGetString("keyboard"))
+		}
+
+		var err error
+		return sc.suspend(L, func() {
+			err = s.bot.EditMessage(chatID, messageID, m)
+		}, func(L *lua.LState) int {
+			return pushResult(L, err)
+		})
+	}
+}
+
+// createFnBotUpsert hb.bot.upsert(key, text, {chat = chat_id, group = "family", parse_mode = "HTML", pin = true, keyboard = {...}})
+// updates the message sent with the key earlier in place or sends the new one, returns the list of messages like hb.sendMessage
+func (s *Script) createFnBotUpsert(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		key := L.ToString(1)
+		text := L.ToString(2)
+		opts := L.ToTable(3)
+
+		if s.bot == nil {
+			s.log.Error().Str("script", sc.path).Msg("bot is not initialized")
+			return 0
+		}
+		if len(key) == 0 || len(text) == 0 {
+			s.log.Error().Str("script", sc.path).Msg("bot.upsert incorrect arguments")
+			L.Push(lua.LNil)
+			L.Push(lua.LString("key and text are required"))
+			return 2
+		}
+
+		m := &entity.BotMessage{Text: text}
+		if opts != nil {
+			m.Chats = chatList(opts.RawGetString("chat"))
+			m.Groups = stringList(opts.RawGetString("group"))
+			m.ParseMode = lua.LVAsString(opts.RawGetString("parse_mode"))
+			m.Silent = lua.LVAsBool(opts.RawGetString("silent"))
+			m.Pin = lua.LVAsBool(opts.RawGetString("pin"))
+			m.Keyboard = keyboard(opts.RawGetString("keyboard"))
+		}
+
+		var (
+			sent []*entity.BotSentMessage
+			err  error
+		)
+		return sc.suspend(L, func() {
+			sent, err = s.bot.Upsert(key, m)
+		}, func(L *lua.LState) int {
+			if err != nil {
+				s.log.Error().Err(err).Str("script", sc.path).Str("key", key).Msg("failed to upsert message")
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			return pushSent(L, sent)
+		})
+	}
+}
+
+// createFnDeleteMessage hb.deleteMessage(chat_id, message_id) deletes the sent message
+func (s *Script) createFnDeleteMessage(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		chatID := L.ToInt64(1)
+		messageID := L.ToInt(2)
+
+		if s.bot == nil {
+			s.log.Error().Str("script", sc.path).Msg("bot is not initialized")
+			return 0
+		}
+		if chatID == 0 || messageID == 0 {
+			s.log.Error().Str("script", sc.path).Msg("deleteMessage incorrect arguments")
+			L.Push(lua.LFalse)
+			return 1
+		}
+
+		var err error
+		return sc.suspend(L, func() {
+			err = s.bot.DeleteMessage(chatID, messageID)
+		}, func(L *lua.LState) int {
+			return pushResult(L, err)
+		})
+	}
+}
+
+// botMessage maps the Lua options table to the bot message
+func botMessage(opts *lua.LTable, m *entity.BotMessage) {
+	m.Chats = chatList(opts.RawGetString("chat"))
+	m.Groups = stringList(opts.RawGetString("group"))
+	m.ParseMode = lua.LVAsString(opts.RawGetString("parse_mode"))
+	m.Silent = lua.LVAsBool(opts.RawGetString("silent"))
+	m.DedupeKey, m.DedupeInterval = dedupeOptions(opts)
+	m.Keyboard = keyboard(opts.RawGetString("keyboard"))
+
+	switch {
+	case opts.RawGetString("photo") != lua.LNil:
+		m.File, m.FileKind = attachment(opts.RawGetString("photo")), entity.BotFilePhoto
+	case opts.RawGetString("document") != lua.LNil:
+		m.File, m.FileKind = attachment(opts.RawGetString("document")), entity.BotFileDocument
+	default:
+		m.File = attachment(opts.RawGetString("file"))
+	}
+
+	if loc, ok := opts.RawGetString("location").(*lua.LTable); ok {
+		m.Location = &entity.BotLocation{
+			Latitude:  float64(lua.LVAsNumber(loc.RawGetString("latitude"))),
+			Longitude: float64(lua.LVAsNumber(loc.RawGetString("longitude"))),
+		}
+	}
+}
+
+// chatList converts the chat id or the array of chat ids to the slice
+func chatList(v lua.LValue) []int64 {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return []int64{int64(v)}
+	case *lua.LTable:
+		list := make([]int64, 0, v.Len())
+		v.ForEach(func(_, item lua.LValue) {
+			if id, ok := item.(lua.LNumber); ok {
+				list = append(list, int64(id))
+			}
+		})
+		return list
+	}
+	return nil
+}
+
+// pushSent pushes the list of sent messages {{chat_id = ..., message_id = ...}}
+func pushSent(L *lua.LState, sent []*entity.BotSentMessage) int {
+	t := L.NewTable()
+	for _, msg := range sent {
+		item := L.NewTable()
+		item.RawSetString("chat_id", lua.LNumber(msg.ChatID))
+		item.RawSetString("message_id", lua.LNumber(msg.MessageID))
+		t.Append(item)
+	}
+	L.Push(t)
+	return 1
+}
+
+// pushResult pushes true or false and the error message
+func pushResult(L *lua.LState, err error) int {
+	if err != nil {
+		L.Push(lua.LFalse)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
+
+// keyboard converts rows of buttons {{{text = "...", data = "..."}, {text = "...", url = "..."}}} to the inline keyboard
+func keyboard(v lua.LValue) [][]*entity.BotButton {
+	rows, ok := v.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+
+	kb := make([][]*entity.BotButton, 0, rows.Len())
+	rows.ForEach(func(_, r lua.LValue) {
+		row, ok := r.(*lua.LTable)
+		if !ok {
+			return
+		}
+		buttons := make([]*entity.BotButton, 0, row.Len())
+		row.ForEach(func(_, b lua.LValue) {
+			btn, ok := b.(*lua.LTable)
+			if !ok {
+				return
+			}
+			buttons = append(buttons, &entity.BotButton{
+				Text: lua.LVAsString(btn.RawGetString("text")),
+				Data: lua.LVAsString(btn.RawGetString("data")),
+				URL:  lua.LVAsString(btn.RawGetString("url")),
+			})
+		})
+		if len(buttons) != 0 {
+			kb = append(kb, buttons)
+		}
+	})
+
+	return kb
+}
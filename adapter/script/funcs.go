@@ -5,21 +5,25 @@ import (
 	"time"
 
 	json "github.com/layeh/gopher-json"
+	"github.com/yuin/gluamapper"
 	"github.com/yuin/gopher-lua"
 
 	"github.com/forest33/honeybee/business/entity"
 )
 
 type timer struct {
-	ctx    context.Context
-	cancel context.CancelFunc
-	t      *time.Timer
+	ctx      context.Context
+	cancel   context.CancelFunc
+	t        *time.Timer
+	deadline time.Time
 }
 
 type ticker struct {
-	ctx    context.Context
-	cancel context.CancelFunc
-	t      *time.Ticker
+	ctx       context.Context
+	cancel    context.CancelFunc
+	t         *time.Ticker
+	interval  time.Duration
+	startedAt time.Time
 }
 
 type alarm struct {
@@ -50,23 +54,48 @@ func (s *Script) preloadFunctions(sc *script) {
 		t := sc.state.NewTable()
 		sc.state.SetFuncs(t, map[string]lua.LGFunction{
 			scriptFuncPublish:      s.createFnPublish(sc),
+			scriptFuncRetry:        s.createFnRetry(sc),
 			scriptFuncNewTimer:     s.createFnNewTimer(sc),
 			scriptFuncNewTicker:    s.createFnNewTicker(sc),
 			scriptFuncNewAlarm:     s.createFnNewAlarm(sc),
 			scriptFuncStopTimer:    s.createFnStopTimer(sc),
 			scriptFuncStopTicker:   s.createFnStopTicker(sc),
 			scriptFuncStopAlarm:    s.createFnStopAlarm(sc),
-			scriptFuncSendMessage:  s.createFnSendMessage(sc),
 			scriptFuncPushNotify:   s.createFnPushNotify(sc),
+			scriptFuncAlert:        s.createFnAlert(sc),
+			scriptFuncNotify:       s.createFnNotify(sc),
+			scriptFuncAck:          s.createFnAck(sc),
 			scriptFuncSetGlobal:    s.createFnSetGlobal(sc),
 			scriptFuncGetGlobal:    s.createFnGetGlobal(sc),
 			scriptFuncDeleteGlobal: s.createFnDeleteGlobal(sc),
 		})
+		t.RawSetString(scriptFuncRequest, waitable(sc.state, s.createFnRequest(sc)))
+		t.RawSetString(scriptFuncSendMessage, waitable(sc.state, s.createFnSendMessage(sc)))
+		t.RawSetString(scriptFuncEditMessage, waitable(sc.state, s.createFnEditMessage(sc)))
+		t.RawSetString(scriptFuncDeleteMessage, waitable(sc.state, s.createFnDeleteMessage(sc)))
+		bot := sc.state.NewTable()
+		bot.RawSetString(scriptFuncBotUpsert, waitable(sc.state, s.createFnBotUpsert(sc)))
+		t.RawSetString(scriptTableBot, bot)
 		sc.state.Push(t)
 		return 1
 	})
 }
 
+// waitable wraps the function which suspends the coroutine with sc.suspend, the results are passed through
+// the vararg call because gopher-lua doesn't adjust the values of the resumed coroutine to the expected number
+func waitable(L *lua.LState, f lua.LGFunction) lua.LValue {
+	wrapper, err := L.LoadString(waitWrapper)
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	L.Push(wrapper)
+	L.Push(L.NewFunction(f))
+	L.Call(1, 1)
+	fn := L.Get(-1)
+	L.Pop(1)
+	return fn
+}
+
 func (s *Script) createFnPublish(sc *script) func(L *lua.LState) int {
 	return func(L *lua.LState) int {
 		topic := L.ToString(1)
@@ -91,53 +120,77 @@ func (s *Script) createFnPublish(sc *script) func(L *lua.LState) int {
 	}
 }
 
+// createFnSendMessage hb.sendMessage(text, {chat = chat_id, group = "family", parse_mode = "HTML", silent = true,
+// file = "/path/snapshot.jpg", location = {latitude = ..., longitude = ...}, keyboard = {{{text = "Close", data = "valve:close"}}},
+// dedupe = "leak", interval = 600}) sends the message through Telegram to the chats and groups or to all configured chats
+// and returns the list of sent messages {{chat_id = ..., message_id = ...}}
 func (s *Script) createFnSendMessage(sc *script) func(L *lua.LState) int {
 	return func(L *lua.LState) int {
 		text := L.ToString(1)
+		opts := L.ToTable(2)
 
 		if s.bot == nil {
 			s.log.Error().Str("script", sc.path).Msg("bot is not initialized")
 			return 0
 		}
-		if len(text) == 0 {
+
+		m := &entity.BotMessage{Text: text}
+		if opts != nil {
+			botMessage(opts, m)
+		}
+
+		if len(m.Text) == 0 && m.File == nil && m.Location == nil {
 			s.log.Error().Str("script", sc.path).Msg("empty text")
 			return 0
 		}
 
-		s.bot.SendMessage(text)
-
-		return 0
+		var (
+			sent []*entity.BotSentMessage
+			err  error
+		)
+		return sc.suspend(L, func() {
+			sent, err = s.bot.Send(m)
+		}, func(L *lua.LState) int {
+			if err != nil {
+				s.log.Error().Err(err).Str("script", sc.path).Msg("failed to send message")
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+			return pushSent(L, sent)
+		})
 	}
 }
 
+// createFnPushNotify hb.pushNotify({topic = "...", title = "...", body = "...", tags = {"warning"}, backend = {"ntfy", "email"}, ...}),
+// the legacy form hb.pushNotify(topic, title, body, priority, attach) is also supported
 func (s *Script) createFnPushNotify(sc *script) func(L *lua.LState) int {
 	return func(L *lua.LState) int {
-		topic := L.ToString(1)
-		title := L.ToString(2)
-		body := L.ToString(3)
-		priority := L.ToString(4)
-		attach := L.ToString(5)
-
 		if s.notify == nil {
 			s.log.Error().Str("script", sc.path).Msg("notify is not initialized")
 			return 0
 		}
-		if len(topic) == 0 {
-			s.log.Error().Str("script", sc.path).Msg("empty topic")
-			return 0
+
+		m := &entity.NotificationMessage{}
+		if opts, ok := L.Get(1).(*lua.LTable); ok {
+			if err := notificationMessage(opts, m); err != nil {
+				s.log.Error().Err(err).Str("script", sc.path).Msg("invalid notification options")
+				return 0
+			}
+		} else {
+			m.Topic = L.ToString(1)
+			m.Title = L.ToString(2)
+			m.Body = L.ToString(3)
+			m.Priority = L.ToString(4)
+			m.Attach = L.ToString(5)
 		}
-		if len(body) == 0 {
+
+		if len(m.Body) == 0 && m.File == nil {
 			s.log.Error().Str("script", sc.path).Msg("empty body")
 			return 0
 		}
 
-		s.notify.Push(sc.ctx, &entity.NotificationMessage{
-			Topic:    topic,
-			Title:    title,
-			Body:     body,
-			Priority: priority,
-			Attach:   attach,
-		})
+		s.notify.Push(sc.ctx, m)
 
 		return 0
 	}
@@ -214,3 +267,62 @@ func (s *Script) createFnDeleteGlobal(sc *script) func(L *lua.LState) int {
 		return 1
 	}
 }
+
+// notificationMessage maps the Lua options table to the notification message, only the specified options are changed
+func notificationMessage(opts *lua.LTable, m *entity.NotificationMessage) error {
+	// keys are kept as is, so header and extra names are not changed
+	if err := gluamapper.NewMapper(gluamapper.Option{NameFunc: gluamapper.Id}).Map(opts, m); err != nil {
+		return err
+	}
+	if backends := stringList(opts.RawGetString("backend")); len(backends) != 0 {
+		m.Backends = backends
+	}
+	if key, interval := dedupeOptions(opts); len(key) != 0 {
+		m.DedupeKey, m.DedupeInterval = key, interval
+	}
+	if file := attachment(opts.RawGetString("file")); file != nil {
+		m.File = file
+	}
+	return nil
+}
+
+// attachment converts the file path or the table {name = "...", path = "..."} or {name = "...", data = "..."} to the attachment
+func attachment(v lua.LValue) *entity.Attachment {
+	switch v := v.(type) {
+	case lua.LString:
+		return &entity.Attachment{Path: string(v)}
+	case *lua.LTable:
+		a := &entity.Attachment{
+			Name: lua.LVAsString(v.RawGetString("name")),
+			Path: lua.LVAsString(v.RawGetString("path")),
+		}
+		if data, ok := v.RawGetString("data").(lua.LString); ok {
+			a.Data = []byte(data)
+		}
+		if len(a.Path) == 0 && a.Data == nil {
+			return nil
+		}
+		return a
+	}
+	return nil
+}
+
+// dedupeOptions returns the deduplication key and interval in seconds from the options table
+func dedupeOptions(opts *lua.LTable) (string, time.Duration) {
+	return lua.LVAsString(opts.RawGetString("dedupe")), seconds(opts.RawGetString("interval"))
+}
+
+// stringList converts the string or the array of strings to the slice
+func stringList(v lua.LValue) []string {
+	switch v := v.(type) {
+	case lua.LString:
+		return []string{string(v)}
+	case *lua.LTable:
+		list := make([]string, 0, v.Len())
+		v.ForEach(func(_, item lua.LValue) {
+			list = append(list, item.String())
+		})
+		return list
+	}
+	return nil
+}
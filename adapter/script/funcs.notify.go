@@ -0,0 +1,81 @@
+package script
+
+import (
+	"errors"
+
+	"github.com/yuin/gluamapper"
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// createFnNotify hb.notify(name, data, options) renders the notification template with the data table
+// and sends the result through the notification backends and/or Telegram, options are the same as for hb.pushNotify
+// with the additional telegram = true/false
+func (s *Script) createFnNotify(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		name := L.ToString(1)
+		opts := L.ToTable(3)
+
+		if err := s.notifyTemplate(sc, name, L.Get(2), opts); err != nil {
+			s.log.Error().Err(err).Str("script", sc.path).Str("template", name).Msg("failed to send notification template")
+			L.Push(lua.LFalse)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		L.Push(lua.LTrue)
+
+		return 1
+	}
+}
+
+func (s *Script) notifyTemplate(sc *script, name string, data lua.LValue, opts *lua.LTable) error {
+	t, ok := s.templates[name]
+	if !ok {
+		return errors.New("template not found")
+	}
+
+	title, body, err := t.render(gluamapper.ToGoValue(data, gluamapper.Option{NameFunc: gluamapper.Id}))
+	if err != nil {
+		return err
+	}
+
+	m := &entity.NotificationMessage{
+		Topic:    t.Topic,
+		Title:    title,
+		Body:     body,
+		Priority: t.Priority,
+		Tags:     t.Tags,
+		Backends: t.Backends,
+	}
+	telegram := t.Telegram
+
+	if opts != nil {
+		if err := notificationMessage(opts, m); err != nil {
+			return err
+		}
+		if v := opts.RawGetString("telegram"); v != lua.LNil {
+			telegram = lua.LVAsBool(v)
+		}
+	}
+
+	// like hb.pushNotify, the notification without the topic and backends is sent through the default backends
+	notify := len(m.Topic) != 0 || len(m.Backends) != 0 || !telegram
+
+	if notify {
+		if s.notify == nil {
+			return errors.New("notify is not initialized")
+		}
+		s.notify.Push(sc.ctx, m)
+	}
+
+	if telegram {
+		if s.bot == nil {
+			return errors.New("bot is not initialized")
+		}
+		s.bot.SendMessage(m.BotMessage())
+	}
+
+	return nil
+}
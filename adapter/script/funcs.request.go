@@ -0,0 +1,176 @@
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+const (
+	defaultRequestTimeout = 10 * time.Second
+)
+
+var correlationID atomic.Int64
+
+type responseFilter struct {
+	topic       string
+	correlation string
+	value       string
+	fields      map[string]string
+}
+
+// createFnRequest hb.request(topic, payload, responseFilter, timeout) publishes the payload and waits for the response,
+// responseFilter is a response topic or a table {topic = "...", correlation = "transaction", match = {status = "ok"}}
+func (s *Script) createFnRequest(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		topic := L.ToString(1)
+		payload := L.ToString(2)
+		timeout := time.Duration(float64(L.ToNumber(4)) * float64(time.Second))
+
+		filter, err := newResponseFilter(L.Get(3))
+		if len(topic) == 0 || err != nil {
+			s.log.Error().Err(err).
+				Str("script", sc.path).
+				Str("topic", topic).
+				Msg("request incorrect arguments")
+			L.Push(lua.LNil)
+			L.Push(lua.LString("incorrect arguments"))
+			return 2
+		}
+		if timeout <= 0 {
+			timeout = defaultRequestTimeout
+		}
+
+		if len(filter.correlation) != 0 {
+			payload, filter.value, err = correlate(payload, filter.correlation)
+			if err != nil {
+				s.log.Error().Err(err).Str("script", sc.path).Str("topic", topic).Msg("failed to set correlation field")
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+		}
+
+		s.log.Debug().
+			Str("script", sc.path).
+			Str("topic", topic).
+			Str("payload", payload).
+			Str("response_topic", filter.topic).
+			Msg("sending request")
+
+		e := &entity.RequestEvent{
+			Topic:         topic,
+			Payload:       payload,
+			ResponseTopic: filter.topic,
+			Match:         filter.match,
+			Deadline:      time.Now().Add(timeout),
+			Response:      make(chan entity.MQTTMessage, 1),
+		}
+
+		var resp entity.MQTTMessage
+		return sc.suspend(L, func() {
+			t := time.NewTimer(timeout)
+			defer t.Stop()
+
+			select {
+			case s.requestCh <- e:
+			case <-t.C:
+				return
+			case <-sc.ctx.Done():
+				return
+			}
+
+			select {
+			case resp = <-e.Response:
+			case <-t.C:
+			case <-sc.ctx.Done():
+			}
+		}, func(L *lua.LState) int {
+			if resp == nil {
+				s.log.Debug().Str("script", sc.path).Str("topic", topic).Msg("request timeout")
+				L.Push(lua.LNil)
+				L.Push(lua.LString("timeout"))
+				return 2
+			}
+
+			L.Push(luar.New(L, resp.Data()))
+			L.Push(lua.LNil)
+
+			return 2
+		})
+	}
+}
+
+func newResponseFilter(v lua.LValue) (*responseFilter, error) {
+	f := &responseFilter{}
+
+	switch v := v.(type) {
+	case lua.LString:
+		f.topic = v.String()
+	case *lua.LTable:
+		f.topic = lua.LVAsString(v.RawGetString("topic"))
+		f.correlation = lua.LVAsString(v.RawGetString("correlation"))
+		if match, ok := v.RawGetString("match").(*lua.LTable); ok {
+			f.fields = make(map[string]string, match.Len())
+			match.ForEach(func(k, v lua.LValue) {
+				f.fields[k.String()] = v.String()
+			})
+		}
+	}
+
+	if len(f.topic) == 0 {
+		return nil, errors.New("empty response topic")
+	}
+
+	return f, nil
+}
+
+func (f *responseFilter) match(m entity.MQTTMessage) bool {
+	data := m.Data()
+	if len(f.correlation) != 0 && valueString(data[f.correlation]) != f.value {
+		return false
+	}
+	for k, v := range f.fields {
+		if valueString(data[k]) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// correlate returns the value of the correlation field, the field is added to the payload if it does not exist
+func correlate(payload, field string) (string, string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		return "", "", err
+	}
+
+	if v, ok := data[field]; ok {
+		return payload, valueString(v), nil
+	}
+
+	value := strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatInt(correlationID.Add(1), 36)
+	data[field] = value
+
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(buf), value, nil
+}
+
+func valueString(v interface{}) string {
+	if n, ok := v.(float64); ok {
+		return lua.LNumber(n).String()
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,183 @@
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	gluajson "github.com/layeh/gopher-json"
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/pkg/scheduler"
+)
+
+const (
+	taskKindRetry      = "script.retry"
+	taskSenderPrefix   = "script:"
+	retryOptAttempts   = "attempts"
+	retryOptDelay      = "delay"
+	retryOptMaxDelay   = "max_delay"
+	retryOptMultiplier = "multiplier"
+	retryOptJitter     = "jitter"
+)
+
+// retryJob is the payload of the scheduler task which calls the Lua function
+type retryJob struct {
+	Path     string          `json:"path"`
+	ScriptID int64           `json:"script_id"`
+	Name     string          `json:"name"`
+	Fn       string          `json:"fn"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// createFnRetry hb.retry(name, fn_name, data, {attempts = 5, delay = 2, max_delay = 60}) calls the function
+// until it returns anything other than false or nil with an error, delays are in seconds
+func (s *Script) createFnRetry(sc *script) func(L *lua.LState) int {
+	return func(L *lua.LState) int {
+		name := L.ToString(1)
+		fnName := L.ToString(2)
+		opts := L.ToTable(4)
+
+		if len(name) == 0 || len(fnName) == 0 {
+			s.log.Error().Str("script", sc.path).Str("name", name).Str("fn", fnName).Msg("retry incorrect arguments")
+			L.Push(lua.LFalse)
+			L.Push(lua.LString("incorrect arguments"))
+			return 2
+		}
+
+		if s.sched == nil {
+			s.log.Error().Str("script", sc.path).Str("name", name).Msg("scheduler is disabled")
+			L.Push(lua.LFalse)
+			L.Push(lua.LString("scheduler is disabled"))
+			return 2
+		}
+
+		data, err := gluajson.Encode(L.Get(3))
+		if err != nil {
+			s.log.Error().Err(err).Str("script", sc.path).Str("name", name).Msg("failed to encode retry data")
+			L.Push(lua.LFalse)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		payload, err := json.Marshal(&retryJob{
+			Path:     sc.path,
+			ScriptID: sc.id,
+			Name:     name,
+			Fn:       fnName,
+			Data:     data,
+		})
+		if err != nil {
+			s.log.Error().Err(err).Str("script", sc.path).Str("name", name).Msg("failed to marshal retry job")
+			L.Push(lua.LFalse)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		t := &scheduler.Task{
+			Sender:    sc.retrySender(),
+			Kind:      taskKindRetry,
+			Payload:   payload,
+			Immediate: true,
+			Volatile:  true,
+		}
+
+		if opts != nil {
+			t.MaxAttempts = int(lua.LVAsNumber(opts.RawGetString(retryOptAttempts)))
+			t.Backoff = scheduler.Backoff{
+				Delay:      seconds(opts.RawGetString(retryOptDelay)),
+				Multiplier: float64(lua.LVAsNumber(opts.RawGetString(retryOptMultiplier))),
+				MaxDelay:   seconds(opts.RawGetString(retryOptMaxDelay)),
+				Jitter:     scheduler.Jitter(lua.LVAsString(opts.RawGetString(retryOptJitter))),
+			}
+		}
+
+		s.sched.AddTask(t)
+
+		L.Push(lua.LTrue)
+
+		return 1
+	}
+}
+
+// retryTask is the scheduler handler of the retry jobs, the function is called in the script event queue
+func (s *Script) retryTask(payload []byte) error {
+	job := &retryJob{}
+	if err := json.Unmarshal(payload, job); err != nil {
+		s.log.Error().Err(err).Msg("failed to unmarshal retry job")
+		return nil
+	}
+
+	v, ok := s.scripts.Load(job.Path)
+	if !ok || v.(*script).id != job.ScriptID {
+		s.log.Warn().Str("script", job.Path).Str("name", job.Name).Msg("script is not loaded, retry job dropped")
+		return nil
+	}
+	sc := v.(*script)
+
+	errCh := make(chan error, 1)
+	sc.call(func() {
+		sc.callRetryFn(job, func(err error) { errCh <- err })
+	})
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, ErrScriptUnloaded) {
+			return nil
+		}
+		if err != nil {
+			s.log.Debug().Err(err).Str("script", sc.path).Str("name", job.Name).Msg("retry job failed")
+		}
+		return err
+	case <-sc.ctx.Done():
+		return nil
+	}
+}
+
+// callRetryFn calls fn(name, data) and passes the result to done, false or nil with an error are treated as a failure
+func (s *script) callRetryFn(job *retryJob, done func(err error)) {
+	fn := s.state.GetGlobal(job.Fn)
+	if fn.Type() != lua.LTFunction {
+		done(errors.New("function " + job.Fn + " not found"))
+		return
+	}
+
+	data, err := gluajson.Decode(s.state, job.Data)
+	if err != nil {
+		done(err)
+		return
+	}
+
+	s.invoke(fn, func(values []lua.LValue, err error) {
+		if err != nil {
+			done(err)
+			return
+		}
+
+		ret, errMsg := lua.LValue(lua.LNil), lua.LValue(lua.LNil)
+		if len(values) > 0 {
+			ret = values[0]
+		}
+		if len(values) > 1 {
+			errMsg = values[1]
+		}
+
+		switch {
+		case ret == lua.LFalse && errMsg == lua.LNil:
+			done(errors.New("function returned false"))
+		case ret == lua.LFalse, ret == lua.LNil && errMsg != lua.LNil:
+			done(errors.New(lua.LVAsString(errMsg)))
+		default:
+			done(nil)
+		}
+	}, lua.LString(job.Name), data)
+}
+
+func (s *script) retrySender() string {
+	return taskSenderPrefix + s.path
+}
+
+// seconds converts the Lua number of seconds to the duration
+func seconds(v lua.LValue) time.Duration {
+	return time.Duration(float64(lua.LVAsNumber(v)) * float64(time.Second))
+}
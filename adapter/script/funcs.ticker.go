@@ -35,17 +35,20 @@ func (s *Script) createFnNewTicker(sc *script) func(L *lua.LState) int {
 					s.log.Debug().Str("script", sc.path).Str("name", name).Msg("ticker finished")
 					return
 				case <-t.t.C:
-					fn := L.GetGlobal(scriptFuncOnTicker)
-					if fn == lua.LNil || fn == nil || sc.state == nil {
-						s.log.Warn().Str("script", sc.path).Msg("OnTicker function not found, resetting timer")
-						return
-					}
-					if err := L.CallByParam(lua.P{
-						Fn:   fn,
-						NRet: 0,
-					}, lua.LString(name), data); err != nil {
-						s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnTicker function")
-					}
+					sc.call(func() {
+						fn := sc.state.GetGlobal(scriptFuncOnTicker)
+						if fn == lua.LNil || fn == nil || sc.state == nil {
+							s.log.Warn().Str("script", sc.path).Msg("OnTicker function not found, resetting timer")
+							sc.deleteTicker(name)
+							return
+						}
+						sc.invoke(fn, func(_ []lua.LValue, err error) {
+							if err != nil {
+								s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnTicker function")
+								sc.fail(scriptFuncOnTicker, err)
+							}
+						}, lua.LString(name), data)
+					})
 				}
 			}
 		}()
@@ -34,18 +34,20 @@ func (s *Script) createFnNewTimer(sc *script) func(L *lua.LState) int {
 				s.log.Debug().Str("script", sc.path).Str("name", name).Msg("timer finished")
 				return
 			case <-t.t.C:
-				fn := L.GetGlobal(scriptFuncOnTimer)
-				if fn == lua.LNil || fn == nil || sc.state == nil {
-					s.log.Warn().Str("script", sc.path).Msg("OnTimer function not found, resetting timer")
-					t.t.Reset(time.Duration(delay))
-					return
-				}
-				if err := L.CallByParam(lua.P{
-					Fn:   fn,
-					NRet: 0,
-				}, lua.LString(name), data); err != nil {
-					s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnTimer function")
-				}
+				sc.call(func() {
+					fn := sc.state.GetGlobal(scriptFuncOnTimer)
+					if fn == lua.LNil || fn == nil || sc.state == nil {
+						s.log.Warn().Str("script", sc.path).Msg("OnTimer function not found, resetting timer")
+						t.t.Reset(time.Duration(delay))
+						return
+					}
+					sc.invoke(fn, func(_ []lua.LValue, err error) {
+						if err != nil {
+							s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnTimer function")
+							sc.fail(scriptFuncOnTimer, err)
+						}
+					}, lua.LString(name), data)
+				})
 			}
 		}()
 
@@ -2,60 +2,142 @@ package script
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/pkg/metrics"
+)
+
+const (
+	moduleName              = "honeybee"
+	scriptFuncInit          = "Init"
+	scriptFuncMain          = "Main"
+	scriptFuncOnMessage     = "OnMessage"
+	scriptFuncOnTimer       = "OnTimer"
+	scriptFuncOnTicker      = "OnTicker"
+	scriptFuncOnAlarm       = "OnAlarm"
+	scriptFuncOnDeadLetter  = "OnDeadLetter"
+	scriptFuncOnNotify      = "OnNotify"
+	scriptFuncOnBotCommand  = "OnBotCommand"
+	scriptFuncOnBotCallback = "OnBotCallback"
+	scriptFuncPublish       = "publish"
+	scriptFuncRequest       = "request"
+	scriptFuncRetry         = "retry"
+	scriptFuncNewTimer      = "newTimer"
+	scriptFuncNewTicker     = "newTicker"
+	scriptFuncNewAlarm      = "newAlarm"
+	scriptFuncStopTimer     = "stopTimer"
+	scriptFuncStopTicker    = "stopTicker"
+	scriptFuncStopAlarm     = "stopAlarm"
+	scriptFuncSendMessage   = "sendMessage"
+	scriptFuncEditMessage   = "editMessage"
+	scriptFuncDeleteMessage = "deleteMessage"
+	scriptFuncPushNotify    = "pushNotify"
+	scriptFuncAlert         = "alert"
+	scriptFuncNotify        = "notify"
+	scriptFuncAck           = "ack"
+	scriptFuncSetGlobal     = "setGlobal"
+	scriptFuncGetGlobal     = "getGlobal"
+	scriptFuncDeleteGlobal  = "deleteGlobal"
+	scriptTableBot          = "bot"
+	scriptFuncBotUpsert     = "upsert"
 )
 
 const (
-	moduleName             = "honeybee"
-	scriptFuncInit         = "Init"
-	scriptFuncMain         = "Main"
-	scriptFuncOnMessage    = "OnMessage"
-	scriptFuncOnTimer      = "OnTimer"
-	scriptFuncOnTicker     = "OnTicker"
-	scriptFuncOnAlarm      = "OnAlarm"
-	scriptFuncPublish      = "publish"
-	scriptFuncNewTimer     = "newTimer"
-	scriptFuncNewTicker    = "newTicker"
-	scriptFuncNewAlarm     = "newAlarm"
-	scriptFuncStopTimer    = "stopTimer"
-	scriptFuncStopTicker   = "stopTicker"
-	scriptFuncStopAlarm    = "stopAlarm"
-	scriptFuncSendMessage  = "sendMessage"
-	scriptFuncPushNotify   = "pushNotify"
-	scriptFuncSetGlobal    = "setGlobal"
-	scriptFuncGetGlobal    = "getGlobal"
-	scriptFuncDeleteGlobal = "deleteGlobal"
+	eventsQueueCapacity = 100
+	waitWrapper         = `local f = ...
+local function pass(...) return ... end
+return function(...) return pass(f(...)) end`
 )
 
+var scriptID atomic.Int64
+
 type Config struct {
 	Folder              []string
 	RegistrySize        int
 	RegistryMaxSize     int
 	RegistryGrowStep    int
 	IncludeGoStackTrace bool
+	Templates           []Template
+	TemplatesFolder     string
 }
 
 type scriptInitResponse struct {
 	Name        string
 	Description string
-	Subscribe   []string
+	Subscribe   []interface{}
+	Notify      []string
+	Commands    []string
 	Disabled    bool
 }
 
+// subscription is an element of the Subscribe list, it is either a topic or a table {Topic = "...", Retained = false}
+type subscription struct {
+	topic      string
+	noRetained bool
+}
+
 type script struct {
+	id          int64
 	name        string
 	description string
 	path        string
 	subscribe   []string
+	notify      []string
+	commands    []string
 	state       *lua.LState
 	ctx         context.Context
 	cancel      context.CancelFunc
 	timers      *sync.Map
 	tickers     *sync.Map
 	alarms      *sync.Map
+	events      chan func()
+	running     *coroutine              // the coroutine which is being resumed by the event queue
+	suspended   map[*coroutine]struct{} // the coroutines waiting for the blocking functions, guarded by mu
+	lastError   atomic.Pointer[scriptError]
+	busySince   atomic.Int64 // unix nanoseconds since the running handler holds the Lua state, 0 if it is idle
+	mu          sync.Mutex
+}
+
+// scriptError is the last error returned by the script event handler
+type scriptError struct {
+	err string
+	at  time.Time
+}
+
+// coroutine is the Lua thread of the event handler, the thread is suspended while the handler waits
+// for a blocking operation
+type coroutine struct {
+	thread  *lua.LState
+	cancel  context.CancelFunc
+	done    func(values []lua.LValue, err error)
+	waiting bool
+}
+
+func (r *scriptInitResponse) subscriptions() ([]*subscription, error) {
+	subs := make([]*subscription, 0, len(r.Subscribe))
+	for _, v := range r.Subscribe {
+		switch v := v.(type) {
+		case string:
+			subs = append(subs, &subscription{topic: v})
+		case map[interface{}]interface{}:
+			topic, ok := v["Topic"].(string)
+			if !ok || len(topic) == 0 {
+				return nil, errors.New("subscription topic is not specified")
+			}
+			retained, ok := v["Retained"].(bool)
+			subs = append(subs, &subscription{topic: topic, noRetained: ok && !retained})
+		default:
+			return nil, fmt.Errorf("invalid subscription: %v", v)
+		}
+	}
+	return subs, nil
 }
 
 func newScript(ctx context.Context, cfg *Config, path string) *script {
@@ -69,13 +151,16 @@ func newScript(ctx context.Context, cfg *Config, path string) *script {
 	})
 
 	sc := &script{
-		path:    path,
-		state:   state,
-		ctx:     ctx,
-		cancel:  cancel,
-		timers:  &sync.Map{},
-		tickers: &sync.Map{},
-		alarms:  &sync.Map{},
+		id:        scriptID.Add(1),
+		path:      path,
+		state:     state,
+		ctx:       ctx,
+		cancel:    cancel,
+		timers:    &sync.Map{},
+		tickers:   &sync.Map{},
+		alarms:    &sync.Map{},
+		events:    make(chan func(), eventsQueueCapacity),
+		suspended: make(map[*coroutine]struct{}),
 	}
 
 	sc.state.SetContext(ctx)
@@ -86,9 +171,10 @@ func newScript(ctx context.Context, cfg *Config, path string) *script {
 func (s *script) createTimer(name string, delay time.Duration) *timer {
 	ctx, cancel := context.WithCancel(s.ctx)
 	t := &timer{
-		ctx:    ctx,
-		cancel: cancel,
-		t:      time.NewTimer(delay),
+		ctx:      ctx,
+		cancel:   cancel,
+		t:        time.NewTimer(delay),
+		deadline: time.Now().Add(delay),
 	}
 	_, loaded := s.timers.LoadOrStore(name, t)
 	if loaded {
@@ -111,9 +197,11 @@ func (s *script) deleteTimer(name string) bool {
 func (s *script) createTicker(name string, interval time.Duration) *ticker {
 	ctx, cancel := context.WithCancel(s.ctx)
 	t := &ticker{
-		ctx:    ctx,
-		cancel: cancel,
-		t:      time.NewTicker(interval),
+		ctx:       ctx,
+		cancel:    cancel,
+		t:         time.NewTicker(interval),
+		interval:  interval,
+		startedAt: time.Now(),
 	}
 	_, loaded := s.tickers.LoadOrStore(name, t)
 	if loaded {
@@ -163,8 +251,158 @@ func (s *script) deleteAlarm(name string) bool {
 	return true
 }
 
+// call queues the event handler, handlers are executed in the order they are queued
+func (s *script) call(f func()) {
+	queuedAt := time.Now()
+	s.enqueue(func() {
+		f()
+		metrics.ScriptDispatch.WithLabelValues(filepath.Base(s.path)).Observe(time.Since(queuedAt).Seconds())
+	})
+}
+
+func (s *script) enqueue(f func()) {
+	select {
+	case s.events <- f:
+	case <-s.ctx.Done():
+	}
+}
+
+func (s *script) runEvents() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case f := <-s.events:
+			s.mu.Lock()
+			// the state is closed after the context is canceled
+			if s.ctx.Err() == nil {
+				s.busySince.Store(time.Now().UnixNano())
+				f()
+				s.busySince.Store(0)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// start calls the Lua function in a new coroutine outside the event queue, the function holds the Lua state until it
+// returns or waits, after the wait it is resumed in the event queue like the event handlers
+func (s *script) start(fn lua.LValue, done func(values []lua.LValue, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the state is closed after the context is canceled
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.busySince.Store(time.Now().UnixNano())
+	s.invoke(fn, done)
+	s.busySince.Store(0)
+}
+
+// invoke calls the Lua function in a new coroutine, done is called with the returned values or the error
+// when the function returns. It must be called in the event queue.
+func (s *script) invoke(fn lua.LValue, done func(values []lua.LValue, err error), args ...lua.LValue) {
+	f, ok := fn.(*lua.LFunction)
+	if !ok {
+		done(nil, fmt.Errorf("attempt to call a %s value", fn.Type()))
+		return
+	}
+
+	thread, cancel := s.state.NewThread()
+	s.resume(&coroutine{thread: thread, cancel: cancel, done: done}, f, args...)
+}
+
+// resume runs the coroutine until it returns or waits
+func (s *script) resume(co *coroutine, fn *lua.LFunction, args ...lua.LValue) {
+	co.waiting = false
+	s.running = co
+	st, err, values := s.state.Resume(co.thread, fn, args...)
+	s.running = nil
+
+	if st == lua.ResumeYield {
+		if co.waiting {
+			return
+		}
+		err = errors.New("event handlers can't yield")
+	}
+
+	if co.cancel != nil {
+		co.cancel()
+	}
+	co.done(values, err)
+}
+
+// suspend runs the blocking function f outside the event queue, the coroutine of the event handler is suspended
+// until f returns and other events of the script are handled meanwhile. The coroutine is resumed in the event queue
+// with the values pushed by result. Functions which can't be suspended (Init, pcall, Go callbacks) block the script.
+func (s *script) suspend(L *lua.LState, f func(), result func(L *lua.LState) int) int {
+	co := s.running
+	if co == nil || co.thread != L || !yieldable(L) {
+		f()
+		return result(L)
+	}
+
+	co.waiting = true
+	s.suspended[co] = struct{}{}
+	go func() {
+		f()
+		s.enqueue(func() {
+			delete(s.suspended, co)
+			n := result(co.thread)
+			values := make([]lua.LValue, n)
+			for i := range values {
+				values[i] = co.thread.Get(i - n)
+			}
+			co.thread.Pop(n)
+			s.resume(co, nil, values...)
+		})
+	}()
+
+	return L.Yield()
+}
+
+// yieldable reports whether there are no Go functions between the coroutine and the current function,
+// gopher-lua can't yield across them
+func yieldable(L *lua.LState) bool {
+	for level := 1; ; level++ {
+		dbg, ok := L.GetStack(level)
+		if !ok {
+			return true
+		}
+		if _, err := L.GetInfo("S", dbg, lua.LNil); err == nil && dbg.What == "G" {
+			return false
+		}
+	}
+}
+
+// fail records the error of the event handler
+func (s *script) fail(callback string, err error) {
+	s.lastError.Store(&scriptError{err: luaError(err).Error(), at: time.Now()})
+	metrics.ScriptErrors.WithLabelValues(filepath.Base(s.path), callback).Inc()
+}
+
+// luaError removes the stack trace from the error raised by the script
+func luaError(err error) error {
+	var apiErr *lua.ApiError
+	if errors.As(err, &apiErr) && apiErr.Object != nil {
+		return errors.New(apiErr.Object.String())
+	}
+	return err
+}
+
+// close cancels the script context and closes the Lua state, the suspended coroutines are finished
+// with ErrScriptUnloaded because they are never resumed
 func (s *script) close() {
 	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for co := range s.suspended {
+		delete(s.suspended, co)
+		if co.cancel != nil {
+			co.cancel()
+		}
+		co.done(nil, ErrScriptUnloaded)
+	}
 	s.state.Close()
 }
 
@@ -0,0 +1,237 @@
+package script
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	json "github.com/layeh/gopher-json"
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/metrics"
+)
+
+var (
+	ErrScriptNotFound = errors.New("script not found")
+	ErrScriptDisabled = errors.New("script is disabled")
+	ErrScriptEnabled  = errors.New("script is not disabled")
+)
+
+// Scripts returns loaded, disabled and failed scripts sorted by path
+func (s *Script) Scripts() []*entity.ScriptInfo {
+	scripts := make([]*entity.ScriptInfo, 0)
+
+	s.scripts.Range(func(_, v interface{}) bool {
+		sc := v.(*script)
+		info := &entity.ScriptInfo{
+			Path:        sc.path,
+			Name:        sc.name,
+			Description: sc.description,
+			State:       entity.ScriptStateLoaded,
+			Subscribe:   sc.subscribe,
+			Notify:      sc.notify,
+			Commands:    sc.commands,
+		}
+		if e := sc.lastError.Load(); e != nil {
+			info.Error, info.ErrorAt = e.err, &e.at
+		}
+		if t := sc.busySince.Load(); t != 0 {
+			busy := time.Unix(0, t)
+			info.BusySince = &busy
+		}
+		scripts = append(scripts, info)
+		return true
+	})
+
+	s.inactive.Range(func(_, v interface{}) bool {
+		info := *v.(*entity.ScriptInfo)
+		scripts = append(scripts, &info)
+		return true
+	})
+
+	slices.SortFunc(scripts, func(a, b *entity.ScriptInfo) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return scripts
+}
+
+// EnableScript loads the script disabled by DisableScript
+func (s *Script) EnableScript(name string) error {
+	path, ok := s.findScript(name)
+	if !ok {
+		return ErrScriptNotFound
+	}
+	if _, ok := s.disabled.LoadAndDelete(path); !ok {
+		return ErrScriptEnabled
+	}
+
+	s.log.Info().Str("path", path).Msg("script enabled")
+
+	return s.reloadFile(path)
+}
+
+// DisableScript unloads the script, it is not loaded again until EnableScript is called
+func (s *Script) DisableScript(name string) error {
+	path, ok := s.findScript(name)
+	if !ok {
+		return ErrScriptNotFound
+	}
+	if _, loaded := s.disabled.LoadOrStore(path, struct{}{}); loaded {
+		return ErrScriptDisabled
+	}
+
+	info := &entity.ScriptInfo{Path: path, Name: filepath.Base(path), State: entity.ScriptStateDisabled}
+	if sc, ok := s.scripts.LoadAndDelete(path); ok {
+		info.Name = sc.(*script).name
+		info.Description = sc.(*script).description
+		s.unloadScript(sc.(*script))
+	}
+	s.inactive.Store(path, info)
+
+	s.log.Info().Str("path", path).Msg("script disabled")
+
+	return nil
+}
+
+// ReloadScript reloads the script from the file
+func (s *Script) ReloadScript(name string) error {
+	path, ok := s.findScript(name)
+	if !ok {
+		return ErrScriptNotFound
+	}
+	if _, ok := s.disabled.Load(path); ok {
+		return ErrScriptDisabled
+	}
+
+	return s.reloadFile(path)
+}
+
+// Globals returns global variables set by hb.setGlobal, tables are encoded as JSON
+func (s *Script) Globals() map[string]string {
+	globals := make(map[string]string)
+
+	s.globalVars.Range(func(k, v interface{}) bool {
+		switch v := v.(type) {
+		case *lua.LTable:
+			data, err := json.Encode(v)
+			if err != nil {
+				globals[k.(string)] = v.String()
+			} else {
+				globals[k.(string)] = string(data)
+			}
+		case lua.LValue:
+			globals[k.(string)] = v.String()
+		}
+		return true
+	})
+
+	return globals
+}
+
+// Timers returns active timers, tickers and alarms of the loaded scripts sorted by the next run
+func (s *Script) Timers() []*entity.TimerInfo {
+	timers := make([]*entity.TimerInfo, 0)
+	now := time.Now()
+
+	s.scripts.Range(func(_, v interface{}) bool {
+		sc := v.(*script)
+		sc.timers.Range(func(k, v interface{}) bool {
+			timers = append(timers, &entity.TimerInfo{
+				Script: sc.path,
+				Name:   k.(string),
+				Kind:   entity.TimerKindTimer,
+				Next:   v.(*timer).deadline,
+			})
+			return true
+		})
+		sc.tickers.Range(func(k, v interface{}) bool {
+			t := v.(*ticker)
+			timers = append(timers, &entity.TimerInfo{
+				Script: sc.path,
+				Name:   k.(string),
+				Kind:   entity.TimerKindTicker,
+				Next:   now.Add(t.interval - now.Sub(t.startedAt)%t.interval),
+			})
+			return true
+		})
+		sc.alarms.Range(func(k, v interface{}) bool {
+			info := &entity.TimerInfo{
+				Script: sc.path,
+				Name:   k.(string),
+				Kind:   entity.TimerKindAlarm,
+			}
+			if d, err := v.(*alarm).getDelay(); err == nil {
+				info.Next = now.Add(d)
+			}
+			timers = append(timers, info)
+			return true
+		})
+		return true
+	})
+
+	slices.SortFunc(timers, func(a, b *entity.TimerInfo) int {
+		return a.Next.Compare(b.Next)
+	})
+
+	return timers
+}
+
+// findScript returns the path of the script by the path, the file name with or without extension or the script name
+func (s *Script) findScript(name string) (path string, ok bool) {
+	match := func(p, scriptName string) bool {
+		base := filepath.Base(p)
+		return p == name || base == name || strings.TrimSuffix(base, filepath.Ext(base)) == name || scriptName == name
+	}
+
+	s.scripts.Range(func(k, v interface{}) bool {
+		if match(k.(string), v.(*script).name) {
+			path, ok = k.(string), true
+			return false
+		}
+		return true
+	})
+	if ok {
+		return
+	}
+
+	s.inactive.Range(func(k, v interface{}) bool {
+		if match(k.(string), v.(*entity.ScriptInfo).Name) {
+			path, ok = k.(string), true
+			return false
+		}
+		return true
+	})
+
+	return
+}
+
+// registerMetrics registers gauges of the scripts and timers
+func (s *Script) registerMetrics() {
+	metrics.RegisterGaugeFunc("scripts", "Scripts per state", "state", func() map[string]float64 {
+		states := map[string]float64{
+			entity.ScriptStateLoaded:   0,
+			entity.ScriptStateDisabled: 0,
+			entity.ScriptStateFailed:   0,
+		}
+		for _, sc := range s.Scripts() {
+			states[sc.State]++
+		}
+		return states
+	})
+
+	metrics.RegisterGaugeFunc("script_timers", "Active timers, tickers and alarms of the scripts", "kind", func() map[string]float64 {
+		kinds := map[string]float64{
+			entity.TimerKindTimer:  0,
+			entity.TimerKindTicker: 0,
+			entity.TimerKindAlarm:  0,
+		}
+		for _, t := range s.Timers() {
+			kinds[t.Kind]++
+		}
+		return kinds
+	})
+}
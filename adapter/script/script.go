@@ -14,20 +14,30 @@ import (
 
 	"github.com/forest33/honeybee/business/entity"
 	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/scheduler"
 	"github.com/forest33/honeybee/pkg/structs"
 )
 
 type Script struct {
-	ctx         context.Context
-	cfg         *Config
-	log         *logger.Logger
-	scripts     *sync.Map
-	watcher     *watcher.Watcher
-	subscribeCh chan *entity.SubscribeEvent
-	publishCh   chan *entity.PublishEvent
-	bot         entity.BotHandler
-	notify      entity.NotificationHandler
-	globalVars  *sync.Map
+	ctx           context.Context
+	cfg           *Config
+	log           *logger.Logger
+	scripts       *sync.Map
+	watcher       *watcher.Watcher
+	subscribeCh   chan *entity.SubscribeEvent
+	publishCh     chan *entity.PublishEvent
+	requestCh     chan *entity.RequestEvent
+	notifyCh      chan *entity.NotifySubscribeEvent
+	commandCh     chan *entity.BotCommandEvent
+	unsubscribeCh chan *entity.UnsubscribeEvent
+	bot           entity.BotHandler
+	notify        entity.NotificationHandler
+	alert         entity.AlertHandler
+	sched         entity.SchedulerHandler
+	globalVars    *sync.Map
+	inactive      *sync.Map // path -> *entity.ScriptInfo of disabled and failed scripts
+	disabled      *sync.Map // paths of the scripts disabled at runtime
+	templates     map[string]*notificationTemplate
 }
 
 func New(ctx context.Context, cfg *Config, log *logger.Logger) *Script {
@@ -37,6 +47,8 @@ func New(ctx context.Context, cfg *Config, log *logger.Logger) *Script {
 		log:        log,
 		scripts:    &sync.Map{},
 		globalVars: &sync.Map{},
+		inactive:   &sync.Map{},
+		disabled:   &sync.Map{},
 	}
 
 	entity.GetWg(ctx).Add(1)
@@ -49,24 +61,164 @@ func New(ctx context.Context, cfg *Config, log *logger.Logger) *Script {
 	return s
 }
 
-func (s *Script) SendMessageEvent(scriptPath []string, topic string, payload map[string]interface{}) {
+func (s *Script) SendMessageEvent(scriptPath []string, m entity.MQTTMessage) {
 	for i := range scriptPath {
 		sc, ok := s.scripts.Load(scriptPath[i])
 		if !ok {
-			s.log.Error().Str("script", scriptPath[i]).Str("topic", topic).Msg("script does not exist")
+			s.log.Error().Str("script", scriptPath[i]).Str("topic", m.Topic()).Msg("script does not exist")
 			continue
 		}
 
-		if err := sc.(*script).state.CallByParam(lua.P{
-			Fn:   sc.(*script).state.GetGlobal(scriptFuncOnMessage),
-			NRet: 0,
-		}, lua.LString(topic), luar.New(sc.(*script).state, payload)); err != nil {
-			s.log.Error().Err(err).Str("script", scriptPath[i]).Str("topic", topic).Msg("failed to call OnMessage function")
+		path := scriptPath[i]
+		sc.(*script).call(func() {
+			state := sc.(*script).state
+			sc.(*script).invoke(state.GetGlobal(scriptFuncOnMessage), func(_ []lua.LValue, err error) {
+				if err != nil {
+					s.log.Error().Err(err).Str("script", path).Str("topic", m.Topic()).Msg("failed to call OnMessage function")
+					sc.(*script).fail(scriptFuncOnMessage, err)
+				}
+			}, lua.LString(m.Topic()), luar.New(state, m.Data()), newMessageMeta(state, m))
+		})
+	}
+}
+
+// newMessageMeta creates the metadata table passed to OnMessage
+func newMessageMeta(L *lua.LState, m entity.MQTTMessage) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("retained", lua.LBool(m.Retained()))
+	t.RawSetString("qos", lua.LNumber(m.QoS()))
+	t.RawSetString("duplicate", lua.LBool(m.Duplicate()))
+	t.RawSetString("message_id", lua.LNumber(m.MessageID()))
+	t.RawSetString("received_at", lua.LNumber(float64(m.ReceivedAt().UnixMilli())/1000))
+	return t
+}
+
+// SendNotifyEvent calls OnNotify(topic, message) of the scripts subscribed to the ntfy topic
+func (s *Script) SendNotifyEvent(scriptPath []string, m *entity.ReceivedNotification) {
+	for i := range scriptPath {
+		sc, ok := s.scripts.Load(scriptPath[i])
+		if !ok {
+			s.log.Error().Str("script", scriptPath[i]).Str("topic", m.Topic).Msg("script does not exist")
+			continue
 		}
+
+		path := scriptPath[i]
+		sc.(*script).call(func() {
+			state := sc.(*script).state
+
+			t := state.NewTable()
+			t.RawSetString("id", lua.LString(m.ID))
+			t.RawSetString("time", lua.LNumber(m.Time))
+			t.RawSetString("title", lua.LString(m.Title))
+			t.RawSetString("message", lua.LString(m.Message))
+			t.RawSetString("priority", lua.LNumber(m.Priority))
+			t.RawSetString("click", lua.LString(m.Click))
+			tags := state.NewTable()
+			structs.ForEach(m.Tags, func(tag string) { tags.Append(lua.LString(tag)) })
+			t.RawSetString("tags", tags)
+
+			sc.(*script).invoke(state.GetGlobal(scriptFuncOnNotify), func(_ []lua.LValue, err error) {
+				if err != nil {
+					s.log.Error().Err(err).Str("script", path).Str("topic", m.Topic).Msg("failed to call OnNotify function")
+					sc.(*script).fail(scriptFuncOnNotify, err)
+				}
+			}, lua.LString(m.Topic), t)
+		})
 	}
 }
 
+// SendBotCommandEvent calls OnBotCommand(chat_id, command, args, message) of the scripts which declared the command
+func (s *Script) SendBotCommandEvent(scriptPath []string, c *entity.BotCommand) {
+	for i := range scriptPath {
+		sc, ok := s.scripts.Load(scriptPath[i])
+		if !ok {
+			s.log.Error().Str("script", scriptPath[i]).Str("command", c.Command).Msg("script does not exist")
+			continue
+		}
+
+		path := scriptPath[i]
+		sc.(*script).call(func() {
+			state := sc.(*script).state
+
+			args := state.NewTable()
+			structs.ForEach(c.Args, func(arg string) { args.Append(lua.LString(arg)) })
+
+			t := state.NewTable()
+			t.RawSetString("message_id", lua.LNumber(c.MessageID))
+			t.RawSetString("user_id", lua.LNumber(c.UserID))
+			t.RawSetString("user_name", lua.LString(c.UserName))
+			t.RawSetString("text", lua.LString(c.Text))
+
+			sc.(*script).invoke(state.GetGlobal(scriptFuncOnBotCommand), func(_ []lua.LValue, err error) {
+				if err != nil {
+					s.log.Error().Err(err).Str("script", path).Str("command", c.Command).Msg("failed to call OnBotCommand function")
+					sc.(*script).fail(scriptFuncOnBotCommand, err)
+				}
+			}, lua.LNumber(c.ChatID), lua.LString(c.Command), args, t)
+		})
+	}
+}
+
+// SendBotCallbackEvent calls OnBotCallback(chat_id, callback_data, message_id, user) of all scripts which define it
+func (s *Script) SendBotCallbackEvent(c *entity.BotCallback) {
+	s.scripts.Range(func(_, v interface{}) bool {
+		sc := v.(*script)
+		sc.call(func() {
+			fn := sc.state.GetGlobal(scriptFuncOnBotCallback)
+			if fn == nil || fn == lua.LNil {
+				return
+			}
+
+			t := sc.state.NewTable()
+			t.RawSetString("user_id", lua.LNumber(c.UserID))
+			t.RawSetString("user_name", lua.LString(c.UserName))
+
+			sc.invoke(fn, func(_ []lua.LValue, err error) {
+				if err != nil {
+					s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnBotCallback function")
+					sc.fail(scriptFuncOnBotCallback, err)
+				}
+			}, lua.LNumber(c.ChatID), lua.LString(c.Data), lua.LNumber(c.MessageID), t)
+		})
+		return true
+	})
+}
+
+// SendDeadLetterEvent passes the exhausted scheduler task to the OnDeadLetter function of all scripts
+func (s *Script) SendDeadLetterEvent(dl *scheduler.DeadLetter) {
+	s.scripts.Range(func(_, v interface{}) bool {
+		sc := v.(*script)
+		sc.call(func() {
+			fn := sc.state.GetGlobal(scriptFuncOnDeadLetter)
+			if fn == nil || fn == lua.LNil {
+				return
+			}
+
+			t := sc.state.NewTable()
+			t.RawSetString("sender", lua.LString(dl.Sender))
+			t.RawSetString("kind", lua.LString(dl.Kind))
+			t.RawSetString("payload", lua.LString(dl.Payload))
+			t.RawSetString("attempts", lua.LNumber(dl.Attempts))
+			t.RawSetString("error", lua.LString(dl.Error))
+			t.RawSetString("created_at", lua.LNumber(dl.CreatedAt.Unix()))
+			t.RawSetString("failed_at", lua.LNumber(dl.FailedAt.Unix()))
+
+			sc.invoke(fn, func(_ []lua.LValue, err error) {
+				if err != nil {
+					s.log.Error().Err(err).Str("script", sc.path).Msg("failed to call OnDeadLetter function")
+					sc.fail(scriptFuncOnDeadLetter, err)
+				}
+			}, t)
+		})
+		return true
+	})
+}
+
 func (s *Script) Start() error {
+	if err := s.initTemplates(); err != nil {
+		return err
+	}
+	s.registerMetrics()
 	s.initWatcher()
 	return s.initScripts()
 }
@@ -79,6 +231,22 @@ func (s *Script) SetPublishChannel(ch chan *entity.PublishEvent) {
 	s.publishCh = ch
 }
 
+func (s *Script) SetRequestChannel(ch chan *entity.RequestEvent) {
+	s.requestCh = ch
+}
+
+func (s *Script) SetNotifySubscribeChannel(ch chan *entity.NotifySubscribeEvent) {
+	s.notifyCh = ch
+}
+
+func (s *Script) SetBotCommandChannel(ch chan *entity.BotCommandEvent) {
+	s.commandCh = ch
+}
+
+func (s *Script) SetUnsubscribeChannel(ch chan *entity.UnsubscribeEvent) {
+	s.unsubscribeCh = ch
+}
+
 func (s *Script) SetBotHandler(bot entity.BotHandler) {
 	s.bot = bot
 }
@@ -87,6 +255,15 @@ func (s *Script) SetNotificationHandler(notify entity.NotificationHandler) {
 	s.notify = notify
 }
 
+func (s *Script) SetAlertHandler(alert entity.AlertHandler) {
+	s.alert = alert
+}
+
+func (s *Script) SetScheduler(sched entity.SchedulerHandler) {
+	s.sched = sched
+	s.sched.RegisterHandler(taskKindRetry, s.retryTask)
+}
+
 func (s *Script) initScripts() error {
 	for _, folder := range s.cfg.Folder {
 		files, err := os.ReadDir(folder)
@@ -121,6 +298,17 @@ func (s *Script) initScripts() error {
 	return nil
 }
 
+// unloadScript cancels the script retry jobs, removes the script from the subscribers and closes the script
+func (s *Script) unloadScript(sc *script) {
+	if s.sched != nil {
+		s.sched.CancelSender(sc.retrySender())
+	}
+	if s.unsubscribeCh != nil {
+		s.unsubscribeCh <- &entity.UnsubscribeEvent{Script: sc}
+	}
+	sc.close()
+}
+
 func (s *Script) loadScript(path string) error {
 	s.log.Debug().Str("path", path).Msg("loading script")
 
@@ -152,35 +340,64 @@ func (s *Script) loadScript(path string) error {
 
 	if init.Disabled {
 		s.log.Info().Str("path", path).Msg("script disabled")
+		s.inactive.Store(path, &entity.ScriptInfo{
+			Path:        path,
+			Name:        init.Name,
+			Description: init.Description,
+			State:       entity.ScriptStateDisabled,
+		})
 		sc.close()
 		return nil
 	}
 
-	sc.subscribe = init.Subscribe
+	subs, err := init.subscriptions()
+	if err != nil {
+		sc.close()
+		return err
+	}
+
+	sc.subscribe = structs.Map(subs, func(sub *subscription) string { return sub.topic })
+	sc.notify = init.Notify
+	sc.commands = init.Commands
 	sc.name = init.Name
 	sc.description = init.Description
 
 	s.scripts.Store(path, sc)
+	s.inactive.Delete(path)
 
-	structs.ForEach(init.Subscribe, func(topic string) {
+	structs.ForEach(subs, func(sub *subscription) {
 		s.subscribeCh <- &entity.SubscribeEvent{
+			Topic:      sub.topic,
+			NoRetained: sub.noRetained,
+			Script:     sc,
+		}
+	})
+
+	structs.ForEach(init.Notify, func(topic string) {
+		s.notifyCh <- &entity.NotifySubscribeEvent{
 			Topic:  topic,
 			Script: sc,
 		}
 	})
 
+	structs.ForEach(init.Commands, func(command string) {
+		s.commandCh <- &entity.BotCommandEvent{
+			Command: command,
+			Script:  sc,
+		}
+	})
+
+	go sc.runEvents()
+
 	fn = sc.state.GetGlobal(scriptFuncMain)
 	if fn == nil || fn == lua.LNil {
 		return nil
 	}
-	go func() {
-		if err := sc.state.CallByParam(lua.P{
-			Fn:   fn,
-			NRet: 1,
-		}); err != nil {
+	go sc.start(fn, func(_ []lua.LValue, err error) {
+		if err != nil && !errors.Is(err, ErrScriptUnloaded) {
 			s.log.Fatalf("main function execution error in %s - %v", path, err)
 		}
-	}()
+	})
 
 	return nil
 }
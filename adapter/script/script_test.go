@@ -0,0 +1,305 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/adapter/mqtt"
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/codec"
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+const testScriptHeader = `
+local hb = require("honeybee")
+local log = {}
+
+function Init()
+    return { Name = "test", Subscribe = {} }
+end
+
+function Ping()
+    table.insert(log, "ping")
+    return "pong"
+end
+
+function Log()
+    return log
+end
+`
+
+// testLog is shared by the tests because the logger sets the global zerolog options
+var testLog = logger.NewDefault()
+
+func newTestScript(t *testing.T, code string) (*Script, *script) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.lua")
+	if err := os.WriteFile(path, []byte(testScriptHeader+code), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(entity.CreateWg(context.Background()))
+	s := New(ctx, &Config{}, testLog)
+	s.SetRequestChannel(make(chan *entity.RequestEvent, 1))
+
+	if err := s.loadScript(path); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	sc, ok := s.scripts.Load(path)
+	if !ok {
+		cancel()
+		t.Fatal("script is not loaded")
+	}
+
+	t.Cleanup(func() {
+		// some tests unload the script themselves
+		if sc.(*script).ctx.Err() == nil {
+			s.unloadScript(sc.(*script))
+		}
+		cancel()
+	})
+
+	return s, sc.(*script)
+}
+
+func call(t *testing.T, s *Script, fn string) string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := s.CallFunction(ctx, "test", fn, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", fn, err)
+	}
+	return string(resp)
+}
+
+func callAsync(s *Script, fn string) <-chan string {
+	ch := make(chan string, 1)
+	go func() {
+		resp, err := s.CallFunction(context.Background(), "test", fn, nil)
+		if err != nil {
+			ch <- err.Error()
+			return
+		}
+		ch <- string(resp)
+	}()
+	return ch
+}
+
+func nextRequest(t *testing.T, s *Script) *entity.RequestEvent {
+	t.Helper()
+
+	select {
+	case e := <-s.requestCh:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("request is not sent")
+		return nil
+	}
+}
+
+func respond(t *testing.T, e *entity.RequestEvent, payload string) {
+	t.Helper()
+
+	m, err := mqtt.NewMessage(codec.NewFastJsonCodec(), e.ResponseTopic, &mqtt.RawMessage{
+		Topic:   e.ResponseTopic,
+		Payload: []byte(payload),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Response <- m
+}
+
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+
+	select {
+	case resp := <-ch:
+		return resp
+	case <-time.After(time.Second):
+		t.Fatal("function didn't return")
+		return ""
+	}
+}
+
+func TestRequestSuspendsHandler(t *testing.T) {
+	s, _ := newTestScript(t, `
+function Request()
+    table.insert(log, "request")
+    local resp, err = hb.request("device/get", "{}", "device/state", 5)
+    table.insert(log, "response")
+    return resp.value, err
+end
+`)
+
+	result := callAsync(s, "Request")
+	e := nextRequest(t, s)
+	if e.Topic != "device/get" || e.ResponseTopic != "device/state" {
+		t.Fatalf("unexpected request %s -> %s", e.Topic, e.ResponseTopic)
+	}
+
+	// the script handles other events while the handler waits for the response
+	if resp := call(t, s, "Ping"); resp != `["pong"]` {
+		t.Fatalf("Ping returned %s", resp)
+	}
+
+	respond(t, e, `{"value":42}`)
+
+	if resp := receive(t, result); resp != `[42,null]` {
+		t.Fatalf("Request returned %s", resp)
+	}
+	if resp := call(t, s, "Log"); resp != `[["request","ping","response"]]` {
+		t.Fatalf("unexpected log %s", resp)
+	}
+}
+
+func TestRequestInsidePcallBlocksScript(t *testing.T) {
+	s, _ := newTestScript(t, `
+function Request()
+    local ok, resp = pcall(hb.request, "device/get", "{}", "device/state", 5)
+    table.insert(log, "response")
+    return ok, resp.value
+end
+`)
+
+	result := callAsync(s, "Request")
+	e := nextRequest(t, s)
+
+	// the coroutine can't yield across pcall, the request holds the script until the response
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := s.CallFunction(ctx, "test", "Ping", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the script to be blocked, got %v", err)
+	}
+
+	respond(t, e, `{"value":42}`)
+
+	if resp := receive(t, result); resp != `[true,42]` {
+		t.Fatalf("Request returned %s", resp)
+	}
+	// Ping was queued after Request and runs after it
+	if resp := call(t, s, "Log"); resp != `[["response","ping"]]` {
+		t.Fatalf("unexpected log %s", resp)
+	}
+}
+
+func TestEventsOrder(t *testing.T) {
+	s, sc := newTestScript(t, `
+function OnMessage(topic, data, meta)
+    table.insert(log, data.n)
+end
+`)
+
+	for i := 1; i <= 5; i++ {
+		m, err := mqtt.NewMessage(codec.NewFastJsonCodec(), "test", &mqtt.RawMessage{
+			Topic:   "test",
+			Payload: []byte(`{"n":` + strconv.Itoa(i) + `}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SendMessageEvent([]string{sc.path}, m)
+	}
+
+	if resp := call(t, s, "Log"); resp != `[[1,2,3,4,5]]` {
+		t.Fatalf("unexpected log %s", resp)
+	}
+}
+
+func TestMainDoesNotBlockEvents(t *testing.T) {
+	s, _ := newTestScript(t, `
+function Main()
+    table.insert(log, "main")
+    local resp = hb.request("device/get", "{}", "device/state", 5)
+    table.insert(log, "main " .. resp.value)
+end
+`)
+
+	e := nextRequest(t, s)
+
+	if resp := call(t, s, "Ping"); resp != `["pong"]` {
+		t.Fatalf("Ping returned %s", resp)
+	}
+
+	respond(t, e, `{"value":"done"}`)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp := call(t, s, "Log")
+		if resp == `[["main","ping","main done"]]` {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected log %s", resp)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseFinishesSuspendedHandlers(t *testing.T) {
+	s, sc := newTestScript(t, `
+function Request()
+    return hb.request("device/get", "{}", "device/state", 5)
+end
+`)
+
+	done := make(chan error, 1)
+	sc.call(func() {
+		sc.invoke(sc.state.GetGlobal("Request"), func(_ []lua.LValue, err error) {
+			done <- err
+		})
+	})
+	nextRequest(t, s)
+
+	s.unloadScript(sc)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrScriptUnloaded) {
+			t.Fatalf("expected ErrScriptUnloaded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("suspended handler is not finished")
+	}
+}
+
+func TestRetryTaskUnloadedScript(t *testing.T) {
+	s, sc := newTestScript(t, `
+function Retry(name, data)
+    return hb.request("device/get", "{}", "device/state", 5)
+end
+`)
+
+	payload, err := json.Marshal(&retryJob{Path: sc.path, ScriptID: sc.id, Name: "job", Fn: "Retry", Data: json.RawMessage("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- s.retryTask(payload) }()
+	nextRequest(t, s)
+
+	s.unloadScript(sc)
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected the job to be dropped, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retry task didn't return")
+	}
+}
@@ -0,0 +1,199 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	templateFileExt    = ".tmpl"
+	defaultTimeLayout  = "2006-01-02 15:04:05"
+	defaultNumberPlace = 2
+)
+
+// Template is a named notification template, Title and Body are Go text/template templates
+type Template struct {
+	Name     string
+	Title    string
+	Body     string
+	Topic    string
+	Priority string
+	Tags     []string
+	Backends []string
+	Telegram bool
+}
+
+type notificationTemplate struct {
+	*Template
+	title *template.Template
+	body  *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"number":   formatNumber,
+	"duration": formatDuration,
+	"time":     formatTime,
+	"now":      func() float64 { return float64(time.Now().UnixMilli()) / 1000 },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"join":     joinList,
+	"default":  defaultValue,
+}
+
+// initTemplates parses templates from config and *.tmpl files of the templates folder,
+// the file name without extension is the template name and the content is the body
+func (s *Script) initTemplates() error {
+	s.templates = make(map[string]*notificationTemplate, len(s.cfg.Templates))
+
+	for i := range s.cfg.Templates {
+		if err := s.addTemplate(&s.cfg.Templates[i]); err != nil {
+			return err
+		}
+	}
+
+	if len(s.cfg.TemplatesFolder) != 0 {
+		if err := s.loadTemplates(s.cfg.TemplatesFolder); err != nil {
+			return err
+		}
+	}
+
+	s.log.Info().Int("templates", len(s.templates)).Msg("notification templates loaded")
+
+	return nil
+}
+
+func (s *Script) loadTemplates(folder string) error {
+	files, err := os.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != templateFileExt {
+			continue
+		}
+
+		body, err := os.ReadFile(filepath.Join(folder, f.Name()))
+		if err != nil {
+			return err
+		}
+
+		if err := s.addTemplate(&Template{
+			Name: strings.TrimSuffix(f.Name(), templateFileExt),
+			Body: string(body),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Script) addTemplate(t *Template) error {
+	if _, ok := s.templates[t.Name]; ok {
+		return fmt.Errorf("duplicate template %s", t.Name)
+	}
+
+	nt := &notificationTemplate{Template: t}
+
+	var err error
+	if nt.title, err = template.New(t.Name).Funcs(templateFuncs).Parse(t.Title); err != nil {
+		return fmt.Errorf("template %s title: %w", t.Name, err)
+	}
+	if nt.body, err = template.New(t.Name).Funcs(templateFuncs).Parse(t.Body); err != nil {
+		return fmt.Errorf("template %s body: %w", t.Name, err)
+	}
+
+	s.templates[t.Name] = nt
+
+	return nil
+}
+
+func (t *notificationTemplate) render(data interface{}) (string, string, error) {
+	title := &bytes.Buffer{}
+	if err := t.title.Execute(title, data); err != nil {
+		return "", "", err
+	}
+
+	body := &bytes.Buffer{}
+	if err := t.body.Execute(body, data); err != nil {
+		return "", "", err
+	}
+
+	return title.String(), body.String(), nil
+}
+
+// formatNumber formats the number with the number of decimal places, 2 by default
+func formatNumber(v interface{}, places ...int) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	p := defaultNumberPlace
+	if len(places) != 0 {
+		p = places[0]
+	}
+	return strconv.FormatFloat(f, 'f', p, 64)
+}
+
+// formatDuration formats seconds as a duration, e.g. 1h2m3s
+func formatDuration(v interface{}) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	return time.Duration(f * float64(time.Second)).Round(time.Second).String()
+}
+
+// formatTime formats the Unix timestamp in seconds with the layout, 2006-01-02 15:04:05 by default
+func formatTime(v interface{}, layout ...string) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	l := defaultTimeLayout
+	if len(layout) != 0 {
+		l = layout[0]
+	}
+	return time.UnixMilli(int64(f * 1000)).Format(l)
+}
+
+func joinList(v interface{}, sep string) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		items = append(items, fmt.Sprint(item))
+	}
+	return strings.Join(items, sep)
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if v == nil || v == "" {
+		return def
+	}
+	return v
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
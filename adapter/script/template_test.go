@@ -0,0 +1,140 @@
+package script
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		v      interface{}
+		places []int
+		want   string
+	}{
+		{21.456, nil, "21.46"},
+		{21.456, []int{1}, "21.5"},
+		{21.456, []int{0}, "21"},
+		{3, nil, "3.00"},
+		{int64(-7), []int{1}, "-7.0"},
+		{"1.5", nil, "1.50"},
+		{"n/a", nil, "n/a"},
+		{nil, nil, "<nil>"},
+	}
+
+	for _, tt := range tests {
+		if got := formatNumber(tt.v, tt.places...); got != tt.want {
+			t.Errorf("number %v %v: got %q, want %q", tt.v, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{0, "0s"},
+		{59.6, "1m0s"},
+		{3723, "1h2m3s"},
+		{"90", "1m30s"},
+		{"soon", "soon"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDuration(tt.v); got != tt.want {
+			t.Errorf("duration %v: got %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	ts := time.Date(2024, 3, 10, 22, 5, 7, 500*int(time.Millisecond), time.Local)
+	sec := float64(ts.UnixMilli()) / 1000
+
+	tests := []struct {
+		v      interface{}
+		layout []string
+		want   string
+	}{
+		{sec, nil, "2024-03-10 22:05:07"},
+		{sec, []string{"15:04:05.000"}, "22:05:07.500"},
+		{int64(ts.Unix()), []string{time.DateOnly}, "2024-03-10"},
+		{"yesterday", nil, "yesterday"},
+	}
+
+	for _, tt := range tests {
+		if got := formatTime(tt.v, tt.layout...); got != tt.want {
+			t.Errorf("time %v %v: got %q, want %q", tt.v, tt.layout, got, tt.want)
+		}
+	}
+}
+
+// fakeNotify records the pushed notifications
+type fakeNotify struct {
+	messages []*entity.NotificationMessage
+}
+
+func (n *fakeNotify) Push(_ context.Context, m *entity.NotificationMessage) {
+	n.messages = append(n.messages, m)
+}
+
+// fakeBot records the queued messages
+type fakeBot struct {
+	entity.BotHandler
+	messages []*entity.BotMessage
+}
+
+func (b *fakeBot) SendMessage(m *entity.BotMessage) {
+	b.messages = append(b.messages, m)
+}
+
+func TestNotifyTemplateDestinations(t *testing.T) {
+	tests := []struct {
+		name     string
+		template Template
+		notify   bool
+		telegram bool
+	}{
+		{"default backends", Template{}, true, false},
+		{"topic", Template{Topic: "home"}, true, false},
+		{"telegram only", Template{Telegram: true}, false, true},
+		{"backends and telegram", Template{Backends: []string{"email"}, Telegram: true}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, sc := newTestScript(t, "")
+			notify, bot := &fakeNotify{}, &fakeBot{}
+			s.SetNotificationHandler(notify)
+			s.SetBotHandler(bot)
+
+			tmpl := tt.template
+			tmpl.Name, tmpl.Title, tmpl.Body = "leak", "Leak", "Water in the {{.room}}"
+			s.cfg.Templates = []Template{tmpl}
+			if err := s.initTemplates(); err != nil {
+				t.Fatal(err)
+			}
+
+			data := &lua.LTable{}
+			data.RawSetString("room", lua.LString("bathroom"))
+			if err := s.notifyTemplate(sc, "leak", data, nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := len(notify.messages) != 0; got != tt.notify {
+				t.Errorf("expected notification %v, got %v", tt.notify, got)
+			}
+			if got := len(bot.messages) != 0; got != tt.telegram {
+				t.Fatalf("expected Telegram message %v, got %v", tt.telegram, got)
+			}
+			if tt.telegram && bot.messages[0].Text != "Leak\n\nWater in the bathroom" {
+				t.Errorf("unexpected Telegram message %q", bot.messages[0].Text)
+			}
+		})
+	}
+}
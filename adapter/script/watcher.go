@@ -7,6 +7,9 @@ import (
 	"time"
 
 	"github.com/radovskyb/watcher"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/metrics"
 )
 
 func (s *Script) initWatcher() {
@@ -94,21 +97,34 @@ func (s *Script) reloadDir(path string) error {
 		s.log.Info().Str("path", removed).Msg("script removed")
 
 		s.scripts.Delete(removed)
-		sc.(*script).close()
+		s.unloadScript(sc.(*script))
 	}
 
 	return nil
 }
 
 func (s *Script) reloadFile(path string) error {
+	if _, ok := s.disabled.Load(path); ok {
+		s.log.Info().Str("path", path).Msg("script is disabled, skipping reload")
+		return nil
+	}
+
 	sc, exists := s.scripts.Load(path)
 	if exists {
 		s.scripts.Delete(path)
-		sc.(*script).close()
+		s.unloadScript(sc.(*script))
 	}
 
-	if err := s.loadScript(path); err != nil {
+	err := s.loadScript(path)
+	metrics.ScriptReloads.WithLabelValues(filepath.Base(path), metrics.Result(err)).Inc()
+	if err != nil {
 		s.log.Error().Err(err).Str("path", path).Msg("failed to load script")
+		s.inactive.Store(path, &entity.ScriptInfo{
+			Path:  path,
+			Name:  filepath.Base(path),
+			State: entity.ScriptStateFailed,
+			Error: err.Error(),
+		})
 		return err
 	}
 
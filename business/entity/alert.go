@@ -0,0 +1,15 @@
+package entity
+
+import "context"
+
+const (
+	// QuietActionHold delays alerts until the end of quiet hours
+	QuietActionHold = "hold"
+	// QuietActionDrop drops alerts during quiet hours
+	QuietActionDrop = "drop"
+)
+
+type AlertHandler interface {
+	Alert(ctx context.Context, channel string, m *NotificationMessage) (string, error)
+	Ack(id string) bool
+}
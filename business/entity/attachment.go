@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultAttachmentName = "attachment"
+)
+
+// Attachment is a local file or content generated by the script, Name is the file name shown to the recipient
+type Attachment struct {
+	Name string
+	Path string
+	Data []byte
+}
+
+// FileName returns the Name or the base name of the Path
+func (a *Attachment) FileName() string {
+	switch {
+	case len(a.Name) != 0:
+		return a.Name
+	case len(a.Path) != 0:
+		return filepath.Base(a.Path)
+	}
+	return defaultAttachmentName
+}
+
+// Load returns the attachment with the content of the file, limit is the maximum size in bytes, 0 - unlimited.
+// The file is read once before the message is queued, so retries send the same content even if the file is changed.
+// nil is returned for the nil attachment.
+func (a *Attachment) Load(limit int64) (*Attachment, error) {
+	if a == nil {
+		return nil, nil
+	}
+	if a.Data != nil {
+		if limit > 0 && int64(len(a.Data)) > limit {
+			return nil, fmt.Errorf("attachment %s is too large: %d bytes, limit %d", a.FileName(), len(a.Data), limit)
+		}
+		return &Attachment{Name: a.FileName(), Data: a.Data}, nil
+	}
+
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && st.Size() > limit {
+		return nil, fmt.Errorf("attachment %s is too large: %d bytes, limit %d", a.FileName(), st.Size(), limit)
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Attachment{Name: a.FileName(), Data: data}, nil
+}
@@ -1,5 +1,115 @@
 package entity
 
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	BotFileAuto     = ""
+	BotFilePhoto    = "photo"
+	BotFileDocument = "document"
+)
+
+// BotParseModePlain sends the text without formatting regardless of the configured parse mode
+const BotParseModePlain = "Plain"
+
+// BotRole is the role of the Telegram user, roles are ordered, each role has the permissions of the previous ones
+type BotRole int
+
+const (
+	BotRoleNone   BotRole = iota // the user is not authorized, updates are dropped
+	BotRoleViewer                // read-only built-in commands
+	BotRoleUser                  // commands of the scripts and inline keyboard buttons
+	BotRoleAdmin                 // built-in commands which change the state
+)
+
+var botRoleNames = map[BotRole]string{
+	BotRoleNone:   "none",
+	BotRoleViewer: "viewer",
+	BotRoleUser:   "user",
+	BotRoleAdmin:  "admin",
+}
+
+func ParseBotRole(name string) (BotRole, error) {
+	for r, n := range botRoleNames {
+		if n == name && r != BotRoleNone {
+			return r, nil
+		}
+	}
+	return BotRoleNone, fmt.Errorf("unknown role %s", name)
+}
+
+func (r BotRole) String() string {
+	return botRoleNames[r]
+}
+
+type BotMessage struct {
+	Chats          []int64  // chat ids, the message is sent to all configured chats if neither Chats nor Groups are specified
+	Groups         []string // names of the recipient groups
+	Text           string
+	ParseMode      string         // MarkdownV2, HTML, Markdown or Plain, the configured parse mode is used if empty
+	Silent         bool           // the message is delivered without sound
+	File           *Attachment    // sent as a photo or a document with the Text as the caption
+	FileKind       string         // photo or document, images up to 10 MB are sent as photos if empty
+	Location       *BotLocation   // sent after the text
+	Keyboard       [][]*BotButton // rows of inline keyboard buttons
+	Pin            bool           // the live message is pinned when it is sent
+	DedupeKey      string         // messages with the same key are sent at most once per DedupeInterval
+	DedupeInterval time.Duration  // overrides the configured interval
+}
+
+type BotLocation struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// BotButton is an inline keyboard button, the Data is passed to OnBotCallback when the button is pressed,
+// buttons with the URL open it instead
+type BotButton struct {
+	Text string
+	Data string
+	URL  string
+}
+
+// BotSentMessage identifies the sent message for editing and deleting
+type BotSentMessage struct {
+	ChatID    int64
+	MessageID int
+}
+
+// BotCommand is a message received from the authorized chat, the Command is empty for messages without a command
+type BotCommand struct {
+	ChatID    int64
+	MessageID int
+	UserID    int64
+	UserName  string
+	Role      BotRole
+	Command   string
+	Args      []string
+	Text      string
+}
+
+// BotCallback is a callback query sent when the inline keyboard button is pressed
+type BotCallback struct {
+	ID        string
+	ChatID    int64
+	MessageID int
+	UserID    int64
+	UserName  string
+	Role      BotRole
+	Data      string
+}
+
 type BotHandler interface {
-	SendMessage(text string)
+	SendMessage(m *BotMessage)
+	Send(m *BotMessage) ([]*BotSentMessage, error)
+	EditMessage(chatID int64, messageID int, m *BotMessage) error
+	DeleteMessage(chatID int64, messageID int) error
+	Upsert(key string, m *BotMessage) ([]*BotSentMessage, error)
+}
+
+type BotSubscriber interface {
+	SubscribeCommands(handler func(c *BotCommand))
+	SubscribeCallbacks(handler func(c *BotCallback))
 }
@@ -1,16 +1,31 @@
 // Package entity provides entities for business logic.
 package entity
 
-import "github.com/forest33/honeybee/pkg/config"
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/forest33/honeybee/pkg/config"
+)
+
+// envAPIHealth overrides API.Health, the Docker image enables the health checks with it
+const envAPIHealth = "HONEYBEE_API_HEALTH"
 
 type Config struct {
 	MQTT         *MQTT         `yaml:"MQTT"`
+	Broker       *Broker       `yaml:"Broker"`
+	Bridge       *Bridge       `yaml:"Bridge"`
 	Logger       *Logger       `yaml:"Logger"`
 	Runtime      *Runtime      `yaml:"Runtime"`
 	Scripts      *Scripts      `yaml:"Scripts"`
 	Scheduler    *Scheduler    `yaml:"Scheduler"`
 	Bot          *Bot          `yaml:"Bot"`
 	Notification *Notification `yaml:"Notification"`
+	Alerts       *Alerts       `yaml:"Alerts"`
+	RateLimit    *RateLimit    `yaml:"RateLimit"`
+	Templates    *Templates    `yaml:"Templates"`
+	API          *API          `yaml:"API"`
 }
 
 type MQTT struct {
@@ -28,33 +43,201 @@ type MQTT struct {
 	Timeout              int    `yaml:"Timeout" default:"10"`
 }
 
+type Broker struct {
+	Enabled   bool              `yaml:"Enabled" default:"false"`
+	Listeners []*BrokerListener `yaml:"Listeners"`
+	AuthFile  string            `yaml:"AuthFile" default:""`
+	StorePath string            `yaml:"StorePath" default:""`
+}
+
+type BrokerListener struct {
+	Type    string `yaml:"Type" default:"tcp"`
+	Address string `yaml:"Address" default:":1883"`
+}
+
+type Bridge struct {
+	Enabled       bool            `yaml:"Enabled" default:"false"`
+	StatsInterval int             `yaml:"StatsInterval" default:"300"`
+	LoopTTL       int             `yaml:"LoopTTL" default:"10"`
+	Brokers       []*BridgeBroker `yaml:"Brokers"`
+	Rules         []*BridgeRule   `yaml:"Rules"`
+}
+
+type BridgeBroker struct {
+	Name                 string `yaml:"Name"`
+	Host                 string `yaml:"Host" default:"127.0.0.1"`
+	Port                 int    `yaml:"Port" default:"1883"`
+	ClientID             string `yaml:"ClientID" default:"honeybee-bridge"`
+	User                 string `yaml:"User" default:""`
+	Password             string `yaml:"Password" default:""`
+	UseTLS               bool   `yaml:"UseTLS"  default:"false"`
+	ServerTLS            bool   `yaml:"ServerTLS"  default:"false"`
+	CACert               string `yaml:"CACert"  default:""`
+	Cert                 string `yaml:"Cert"  default:""`
+	Key                  string `yaml:"Key" default:""`
+	ConnectRetryInterval int    `yaml:"ConnectRetryInterval" default:"3"`
+	Timeout              int    `yaml:"Timeout" default:"10"`
+}
+
+type BridgeRule struct {
+	Name        string `yaml:"Name"`
+	Source      string `yaml:"Source"`
+	Destination string `yaml:"Destination"`
+	Filter      string `yaml:"Filter"`
+	Topic       string `yaml:"Topic" default:""`
+	QoS         int    `yaml:"QoS" default:"0"`
+	Retain      bool   `yaml:"Retain" default:"false"`
+}
+
 type Scripts struct {
 	Folder              []string `yaml:"Folder" default:"./config/scripts"`
 	RegistrySize        int      `yaml:"RegistrySize" default:"32768"`
 	RegistryMaxSize     int      `yaml:"RegistryMaxSize" default:"65536"`
 	RegistryGrowStep    int      `yaml:"RegistryGrowStep" default:"32"`
 	IncludeGoStackTrace bool     `yaml:"IncludeGoStackTrace" default:"false"`
+	HandlerDeadline     int      `yaml:"HandlerDeadline" default:"60"`
 }
 
 type Scheduler struct {
-	Enabled           bool `yaml:"Enabled" default:"true"`
-	MaxTasksPerSender int  `yaml:"MaxTasksPerSender" default:"0"`
+	Enabled           bool    `yaml:"Enabled" default:"true"`
+	MaxTasksPerSender int     `yaml:"MaxTasksPerSender" default:"0"`
+	MaxAttempts       int     `yaml:"MaxAttempts" default:"0"`
+	MaxProcessingTime int     `yaml:"MaxProcessingTime" default:"604800"`
+	Delay             float64 `yaml:"Delay" default:"1"`
+	Multiplier        float64 `yaml:"Multiplier" default:"2"`
+	MaxDelay          float64 `yaml:"MaxDelay" default:"3600"`
+	Jitter            string  `yaml:"Jitter" default:"equal"`
+	DeadLetterSize    int     `yaml:"DeadLetterSize" default:"100"`
+	StorePath         string  `yaml:"StorePath" default:""`
 }
 
 type Bot struct {
-	Enabled       bool    `yaml:"Enabled" default:"false"`
-	Token         string  `yaml:"Token"`
-	ChatId        []int64 `yaml:"ChatId"`
-	UpdateTimeout int     `yaml:"UpdateTimeout" default:"60"`
-	PoolSize      int     `yaml:"PoolSize" default:"2"`
+	Enabled       bool        `yaml:"Enabled" default:"false"`
+	Token         string      `yaml:"Token"`
+	ChatId        []int64     `yaml:"ChatId"`
+	UpdateTimeout int         `yaml:"UpdateTimeout" default:"60"`
+	PoolSize      int         `yaml:"PoolSize" default:"2"`
+	MaxFileSize   int         `yaml:"MaxFileSize" default:"50"`
+	Admins        []int64     `yaml:"Admins"`
+	Users         []*BotUser  `yaml:"Users"`
+	Groups        []*BotGroup `yaml:"Groups"`
+	ParseMode     string      `yaml:"ParseMode" default:""`
+	APIEndpoint   string      `yaml:"APIEndpoint" default:""`
+	// ReportUnauthorized sends updates of unauthorized users to the admins
+	ReportUnauthorized bool `yaml:"ReportUnauthorized" default:"false"`
+	// LiveMessagesFile keeps ids of the messages updated with hb.bot.upsert between restarts
+	LiveMessagesFile string `yaml:"LiveMessagesFile" default:""`
+}
+
+type BotUser struct {
+	Id   int64  `yaml:"Id"`
+	Role string `yaml:"Role" default:"user"`
+}
+
+type BotGroup struct {
+	Name   string  `yaml:"Name"`
+	ChatId []int64 `yaml:"ChatId"`
 }
 
 type Notification struct {
-	Enabled  bool   `yaml:"Enabled" default:"false"`
-	BaseURL  string `yaml:"BaseURL" default:"https://ntfy.sh"`
-	Timeout  int    `yaml:"Timeout" default:"30"`
-	Priority string `yaml:"Priority" default:"default"`
-	PoolSize int    `yaml:"PoolSize" default:"2"`
+	Enabled     bool                    `yaml:"Enabled" default:"false"`
+	BaseURL     string                  `yaml:"BaseURL" default:"https://ntfy.sh"`
+	Timeout     int                     `yaml:"Timeout" default:"30"`
+	Priority    string                  `yaml:"Priority" default:"default"`
+	PoolSize    int                     `yaml:"PoolSize" default:"2"`
+	Token       string                  `yaml:"Token" default:""`
+	User        string                  `yaml:"User" default:""`
+	Password    string                  `yaml:"Password" default:""`
+	MaxFileSize int                     `yaml:"MaxFileSize" default:"15"`
+	Default     []string                `yaml:"Default" default:"ntfy"`
+	Webhook     []*NotificationWebhook  `yaml:"Webhook"`
+	SMTP        []*NotificationSMTP     `yaml:"SMTP"`
+	Gotify      []*NotificationGotify   `yaml:"Gotify"`
+	Pushover    []*NotificationPushover `yaml:"Pushover"`
+}
+
+type NotificationWebhook struct {
+	Name    string            `yaml:"Name"`
+	URL     string            `yaml:"URL"`
+	Method  string            `yaml:"Method" default:"POST"`
+	Headers map[string]string `yaml:"Headers" default:""`
+}
+
+type NotificationSMTP struct {
+	Name     string   `yaml:"Name"`
+	Host     string   `yaml:"Host"`
+	Port     int      `yaml:"Port" default:"587"`
+	User     string   `yaml:"User" default:""`
+	Password string   `yaml:"Password" default:""`
+	From     string   `yaml:"From"`
+	To       []string `yaml:"To"`
+	TLS      bool     `yaml:"TLS" default:"false"`
+}
+
+type NotificationGotify struct {
+	Name  string `yaml:"Name"`
+	URL   string `yaml:"URL"`
+	Token string `yaml:"Token"`
+}
+
+type NotificationPushover struct {
+	Name   string `yaml:"Name"`
+	URL    string `yaml:"URL" default:"https://api.pushover.net/1/messages.json"`
+	Token  string `yaml:"Token"`
+	User   string `yaml:"User"`
+	Device string `yaml:"Device" default:""`
+}
+
+// Templates are notification templates used by hb.notify, *.tmpl files of the Folder are body templates
+type Templates struct {
+	Folder string      `yaml:"Folder" default:""`
+	Items  []*Template `yaml:"Items"`
+}
+
+type Template struct {
+	Name     string   `yaml:"Name"`
+	Title    string   `yaml:"Title" default:""`
+	Body     string   `yaml:"Body"`
+	Topic    string   `yaml:"Topic" default:""`
+	Priority string   `yaml:"Priority" default:""`
+	Tags     []string `yaml:"Tags"`
+	Backends []string `yaml:"Backends"`
+	Telegram bool     `yaml:"Telegram" default:"false"`
+}
+
+// RateLimit limits Telegram messages and notifications per channel (Telegram or notification backend)
+type RateLimit struct {
+	Rate     float64 `yaml:"Rate" default:"0"`
+	Burst    int     `yaml:"Burst" default:"5"`
+	Interval float64 `yaml:"Interval" default:"0"`
+}
+
+type Alerts struct {
+	Channels []*AlertChannel `yaml:"Channels"`
+}
+
+// AlertChannel routes alerts to notification backends and Telegram,
+// alerts which are not acknowledged within EscalateAfter minutes are sent to the EscalateTo channel
+type AlertChannel struct {
+	Name          string   `yaml:"Name"`
+	Notify        bool     `yaml:"Notify" default:"false"`
+	Topic         string   `yaml:"Topic" default:""`
+	Backends      []string `yaml:"Backends"`
+	Priority      string   `yaml:"Priority" default:""`
+	Telegram      bool     `yaml:"Telegram" default:"false"`
+	QuietFrom     string   `yaml:"QuietFrom" default:""`
+	QuietTo       string   `yaml:"QuietTo" default:""`
+	QuietAction   string   `yaml:"QuietAction" default:"hold"`
+	EscalateAfter int      `yaml:"EscalateAfter" default:"0"`
+	EscalateTo    string   `yaml:"EscalateTo" default:""`
+}
+
+type API struct {
+	Enabled bool   `yaml:"Enabled" default:"false"`
+	Health  bool   `yaml:"Health" default:"false"`
+	Listen  string `yaml:"Listen" default:"127.0.0.1:8080"`
+	Timeout int    `yaml:"Timeout" default:"10"`
+	Token   string `yaml:"Token" default:""`
 }
 
 type Logger struct {
@@ -83,5 +266,10 @@ func GetConfig() (ConfigHandler, *Config, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	if v, ok := os.LookupEnv(envAPIHealth); ok {
+		if cfg.API.Health, err = strconv.ParseBool(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", envAPIHealth, err)
+		}
+	}
 	return h, cfg, nil
 }
@@ -1,7 +1,14 @@
 package entity
 
+import "time"
+
 type MQTTMessage interface {
 	Topic() string
 	Payload() []byte
 	Data() map[string]interface{}
+	Retained() bool
+	QoS() byte
+	Duplicate() bool
+	MessageID() uint16
+	ReceivedAt() time.Time
 }
@@ -1,6 +1,9 @@
 package entity
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type NotificationMessage struct {
 	Topic    string
@@ -8,8 +11,65 @@ type NotificationMessage struct {
 	Body     string
 	Priority string
 	Attach   string
+	Tags     []string
+	Click    string
+	Icon     string
+	Delay    string
+	Email    string
+	Markdown bool
+	Actions  []*NotificationAction
+	Backends []string    // names of the notification backends, the default backends are used if empty
+	File     *Attachment `gluamapper:"-"` // uploaded to ntfy, other backends ignore it
+
+	DedupeKey      string        // messages with the same key are sent at most once per DedupeInterval
+	DedupeInterval time.Duration // overrides the configured interval
+}
+
+// BotMessage returns the Telegram message with the title and the body of the notification
+func (m *NotificationMessage) BotMessage() *BotMessage {
+	text := m.Body
+	if len(m.Title) != 0 {
+		text = m.Title + "\n\n" + m.Body
+	}
+
+	return &BotMessage{
+		Text:           text,
+		File:           m.File,
+		DedupeKey:      m.DedupeKey,
+		DedupeInterval: m.DedupeInterval,
+	}
+}
+
+// NotificationAction is an action button, the Action is one of view, http or broadcast
+type NotificationAction struct {
+	Action  string
+	Label   string
+	URL     string
+	Clear   bool
+	Method  string
+	Headers map[string]string
+	Body    string
+	Intent  string
+	Extras  map[string]string
+}
+
+// ReceivedNotification is a message received from the subscribed ntfy topic
+type ReceivedNotification struct {
+	ID       string   `json:"id"`
+	Time     int64    `json:"time"`
+	Event    string   `json:"event"`
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags"`
+	Click    string   `json:"click"`
 }
 
 type NotificationHandler interface {
 	Push(ctx context.Context, m *NotificationMessage)
 }
+
+type NotificationSubscriber interface {
+	Subscribe(topic string, handler func(m *ReceivedNotification))
+}
@@ -0,0 +1,9 @@
+package entity
+
+import "github.com/forest33/honeybee/pkg/scheduler"
+
+type SchedulerHandler interface {
+	AddTask(t *scheduler.Task)
+	RegisterHandler(kind string, h scheduler.TaskHandler)
+	CancelSender(sender string) int
+}
@@ -1,15 +1,98 @@
 package entity
 
+import "time"
+
 type PublishEvent struct {
 	Topic   string
 	Payload string
 }
 
+type RequestEvent struct {
+	Topic         string
+	Payload       string
+	ResponseTopic string
+	Match         func(m MQTTMessage) bool
+	Deadline      time.Time
+	Response      chan MQTTMessage
+}
+
 type SubscribeEvent struct {
+	Topic      string
+	NoRetained bool
+	Script     Script
+}
+
+type NotifySubscribeEvent struct {
 	Topic  string
 	Script Script
 }
 
+// BotCommandEvent subscribes the script to the bot command, "*" subscribes to all messages
+type BotCommandEvent struct {
+	Command string
+	Script  Script
+}
+
+// UnsubscribeEvent removes the unloaded script from the MQTT, notification and bot command subscribers
+type UnsubscribeEvent struct {
+	Script Script
+}
+
+const (
+	ScriptStateLoaded   = "loaded"
+	ScriptStateDisabled = "disabled"
+	ScriptStateFailed   = "failed"
+)
+
+// ScriptInfo describes the script of the scripts folders
+type ScriptInfo struct {
+	Path        string     `json:"path"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	State       string     `json:"state"`
+	Error       string     `json:"error,omitempty"` // the load error or the last error of the event handlers
+	ErrorAt     *time.Time `json:"error_at,omitempty"`
+	BusySince   *time.Time `json:"busy_since,omitempty"` // the start of the running event handler
+	Subscribe   []string   `json:"subscribe,omitempty"`
+	Notify      []string   `json:"notify,omitempty"`
+	Commands    []string   `json:"commands,omitempty"`
+}
+
+const (
+	TimerKindTimer  = "timer"
+	TimerKindTicker = "ticker"
+	TimerKindAlarm  = "alarm"
+)
+
+// Status describes the state of the application
+type Status struct {
+	StartedAt     time.Time      `json:"started_at"`
+	Uptime        string         `json:"uptime"`
+	MQTTConnected bool           `json:"mqtt_connected"`
+	Scripts       map[string]int `json:"scripts"` // number of scripts per state
+}
+
+// Health is the result of the liveness or readiness check, problems are listed if the check failed
+type Health struct {
+	OK       bool     `json:"ok"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Subscriptions lists paths of the scripts subscribed to MQTT topics, ntfy topics and bot commands
+type Subscriptions struct {
+	MQTT     map[string][]string `json:"mqtt"`
+	Notify   map[string][]string `json:"notify"`
+	Commands map[string][]string `json:"commands"`
+}
+
+// TimerInfo describes the timer, ticker or alarm of the script
+type TimerInfo struct {
+	Script string    `json:"script"`
+	Name   string    `json:"name"`
+	Kind   string    `json:"kind"`
+	Next   time.Time `json:"next"`
+}
+
 type Script interface {
 	Path() string
 	Name() string
@@ -0,0 +1,255 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+const (
+	alertIDLength = 8
+)
+
+// AlertUseCase routes alerts of the named channels to notification backends and Telegram
+type AlertUseCase struct {
+	ctx      context.Context
+	cfg      *entity.Config
+	log      *logger.Logger
+	bot      entity.BotHandler
+	notify   entity.NotificationHandler
+	channels map[string]*alertChannel
+	pending  map[string]*time.Timer
+	minute   time.Duration // unit of EscalateAfter, shortened by tests
+	sync.Mutex
+}
+
+type alertChannel struct {
+	*entity.AlertChannel
+	quiet *quietHours
+}
+
+// quietHours is a daily interval in minutes since midnight, from > to for intervals over midnight
+type quietHours struct {
+	from int
+	to   int
+}
+
+func NewAlertUseCase(ctx context.Context, cfg *entity.Config, log *logger.Logger, bot entity.BotHandler, notify entity.NotificationHandler) (*AlertUseCase, error) {
+	uc := &AlertUseCase{
+		ctx:      ctx,
+		cfg:      cfg,
+		log:      log,
+		bot:      bot,
+		notify:   notify,
+		channels: make(map[string]*alertChannel, len(cfg.Alerts.Channels)),
+		pending:  make(map[string]*time.Timer),
+		minute:   time.Minute,
+	}
+
+	for _, ch := range cfg.Alerts.Channels {
+		if _, ok := uc.channels[ch.Name]; ok {
+			return nil, fmt.Errorf("duplicate alert channel %s", ch.Name)
+		}
+
+		c := &alertChannel{AlertChannel: ch}
+		if len(ch.QuietFrom) != 0 || len(ch.QuietTo) != 0 {
+			q, err := newQuietHours(ch.QuietFrom, ch.QuietTo)
+			if err != nil {
+				return nil, fmt.Errorf("alert channel %s: %w", ch.Name, err)
+			}
+			c.quiet = q
+		}
+		if ch.QuietAction != entity.QuietActionHold && ch.QuietAction != entity.QuietActionDrop {
+			return nil, fmt.Errorf("alert channel %s: unknown quiet action %s", ch.Name, ch.QuietAction)
+		}
+		if ch.Notify && notify == nil {
+			log.Warn().Str("channel", ch.Name).Msg("notifications are disabled, alert channel will not use them")
+		}
+		if ch.Telegram && bot == nil {
+			log.Warn().Str("channel", ch.Name).Msg("bot is disabled, alert channel will not use it")
+		}
+
+		uc.channels[ch.Name] = c
+	}
+
+	for _, c := range uc.channels {
+		if len(c.EscalateTo) == 0 {
+			continue
+		}
+		if _, ok := uc.channels[c.EscalateTo]; !ok {
+			return nil, fmt.Errorf("alert channel %s: unknown escalation channel %s", c.Name, c.EscalateTo)
+		}
+	}
+
+	return uc, nil
+}
+
+// Alert sends the message to the channel and returns the alert id used for acknowledgement
+func (uc *AlertUseCase) Alert(ctx context.Context, channel string, m *entity.NotificationMessage) (string, error) {
+	ch, ok := uc.channels[channel]
+	if !ok {
+		return "", fmt.Errorf("unknown alert channel %s", channel)
+	}
+
+	buf := make([]byte, alertIDLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	uc.deliver(ctx, ch, id, m)
+
+	return id, nil
+}
+
+// Ack acknowledges the alert, its escalation or delayed delivery is cancelled
+func (uc *AlertUseCase) Ack(id string) bool {
+	uc.Lock()
+	defer uc.Unlock()
+
+	t, ok := uc.pending[id]
+	if !ok {
+		return false
+	}
+
+	t.Stop()
+	delete(uc.pending, id)
+
+	uc.log.Info().Str("id", id).Msg("alert acknowledged")
+
+	return true
+}
+
+// deliver sends the alert or holds it until the end of quiet hours, the alert is sent without the lock held
+// because the bot and the notification client may block
+func (uc *AlertUseCase) deliver(ctx context.Context, ch *alertChannel, id string, m *entity.NotificationMessage) {
+	if uc.schedule(ch, id, m) {
+		uc.send(ctx, ch, m)
+	}
+}
+
+// schedule starts the timer of the held alert or of its escalation and returns true if the alert should be sent now
+func (uc *AlertUseCase) schedule(ch *alertChannel, id string, m *entity.NotificationMessage) bool {
+	uc.Lock()
+	defer uc.Unlock()
+
+	if d := ch.quiet.remaining(time.Now()); d > 0 {
+		if ch.QuietAction == entity.QuietActionDrop {
+			uc.log.Info().Str("channel", ch.Name).Str("id", id).Msg("alert dropped during quiet hours")
+			return false
+		}
+
+		uc.log.Info().Str("channel", ch.Name).Str("id", id).Dur("delay", d).Msg("alert held until the end of quiet hours")
+		uc.pending[id] = time.AfterFunc(d, func() {
+			if !uc.take(id) {
+				return
+			}
+			// the context of the script may be finished already
+			uc.deliver(uc.ctx, ch, id, m)
+		})
+		return false
+	}
+
+	if ch.EscalateAfter > 0 && len(ch.EscalateTo) != 0 {
+		uc.pending[id] = time.AfterFunc(time.Duration(ch.EscalateAfter)*uc.minute, func() {
+			uc.escalate(ch, id, m)
+		})
+	}
+
+	return true
+}
+
+// take removes the pending alert and returns false if it was acknowledged
+func (uc *AlertUseCase) take(id string) bool {
+	uc.Lock()
+	defer uc.Unlock()
+
+	if _, ok := uc.pending[id]; !ok {
+		return false
+	}
+	delete(uc.pending, id)
+
+	return true
+}
+
+func (uc *AlertUseCase) escalate(ch *alertChannel, id string, m *entity.NotificationMessage) {
+	if !uc.take(id) {
+		return
+	}
+
+	uc.log.Warn().Str("channel", ch.Name).Str("escalate_to", ch.EscalateTo).Str("id", id).Msg("alert is not acknowledged, escalating")
+
+	uc.deliver(uc.ctx, uc.channels[ch.EscalateTo], id, m)
+}
+
+func (uc *AlertUseCase) send(ctx context.Context, ch *alertChannel, m *entity.NotificationMessage) {
+	uc.log.Debug().Str("channel", ch.Name).Str("title", m.Title).Msg("sending alert")
+
+	if ch.Notify && uc.notify != nil {
+		msg := *m
+		if len(msg.Topic) == 0 {
+			msg.Topic = ch.Topic
+		}
+		if len(msg.Backends) == 0 {
+			msg.Backends = ch.Backends
+		}
+		if len(msg.Priority) == 0 {
+			msg.Priority = ch.Priority
+		}
+		uc.notify.Push(ctx, &msg)
+	}
+
+	if ch.Telegram && uc.bot != nil {
+		uc.bot.SendMessage(m.BotMessage())
+	}
+}
+
+func newQuietHours(from, to string) (*quietHours, error) {
+	f, err := parseClock(from)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseClock(to)
+	if err != nil {
+		return nil, err
+	}
+	return &quietHours{from: f, to: t}, nil
+}
+
+// parseClock parses HH:MM and returns minutes since midnight
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid quiet hours time %s", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// remaining returns the duration until the end of quiet hours or zero outside of them
+func (q *quietHours) remaining(now time.Time) time.Duration {
+	if q == nil || q.from == q.to {
+		return 0
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	minute := now.Hour()*60 + now.Minute()
+	end := midnight.Add(time.Duration(q.to) * time.Minute)
+
+	switch {
+	case q.from < q.to && minute >= q.from && minute < q.to:
+	case q.from > q.to && minute >= q.from:
+		end = end.AddDate(0, 0, 1)
+	case q.from > q.to && minute < q.to:
+	default:
+		return 0
+	}
+
+	return end.Sub(now)
+}
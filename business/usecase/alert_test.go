@@ -0,0 +1,183 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+// fakeNotify passes the pushed messages to the channel and reports if the alert lock is held during delivery
+type fakeNotify struct {
+	uc       *AlertUseCase
+	messages chan *entity.NotificationMessage
+	locked   chan bool
+}
+
+func (n *fakeNotify) Push(_ context.Context, m *entity.NotificationMessage) {
+	locked := !n.uc.TryLock()
+	if !locked {
+		n.uc.Unlock()
+	}
+	n.locked <- locked
+	n.messages <- m
+}
+
+func (n *fakeNotify) next(t *testing.T) *entity.NotificationMessage {
+	t.Helper()
+
+	select {
+	case m := <-n.messages:
+		if <-n.locked {
+			t.Error("alert is delivered with the lock held")
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("alert is not delivered")
+		return nil
+	}
+}
+
+func (n *fakeNotify) none(t *testing.T, d time.Duration) {
+	t.Helper()
+
+	select {
+	case m := <-n.messages:
+		t.Fatalf("unexpected alert to %s", m.Topic)
+	case <-time.After(d):
+	}
+}
+
+func newTestAlertUseCase(t *testing.T, channels ...*entity.AlertChannel) (*AlertUseCase, *fakeNotify) {
+	t.Helper()
+
+	n := &fakeNotify{
+		messages: make(chan *entity.NotificationMessage, 4),
+		locked:   make(chan bool, 4),
+	}
+	cfg := &entity.Config{Alerts: &entity.Alerts{Channels: channels}}
+	uc, err := NewAlertUseCase(context.Background(), cfg, logger.NewDefault(), nil, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc.minute = time.Millisecond
+	n.uc = uc
+
+	return uc, n
+}
+
+func escalatingChannels() []*entity.AlertChannel {
+	return []*entity.AlertChannel{
+		{Name: "ops", Notify: true, Topic: "ops", QuietAction: entity.QuietActionHold, EscalateAfter: 50, EscalateTo: "boss"},
+		{Name: "boss", Notify: true, Topic: "boss", QuietAction: entity.QuietActionHold},
+	}
+}
+
+func TestQuietHoursRemaining(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		from, to string
+		now      time.Time
+		want     time.Duration
+	}{
+		{"01:00", "06:00", at(0, 59), 0},
+		{"01:00", "06:00", at(1, 0), 5 * time.Hour},
+		{"01:00", "06:00", at(5, 30), 30 * time.Minute},
+		{"01:00", "06:00", at(6, 0), 0},
+		{"22:00", "07:00", at(21, 59), 0},
+		{"22:00", "07:00", at(22, 0), 9 * time.Hour},
+		{"22:00", "07:00", at(23, 30), 7*time.Hour + 30*time.Minute},
+		{"22:00", "07:00", at(0, 0), 7 * time.Hour},
+		{"22:00", "07:00", at(6, 59), time.Minute},
+		{"22:00", "07:00", at(7, 0), 0},
+		{"22:00", "07:00", at(12, 0), 0},
+		{"08:00", "08:00", at(8, 0), 0},
+	}
+
+	for _, tt := range tests {
+		q, err := newQuietHours(tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := q.remaining(tt.now); got != tt.want {
+			t.Errorf("%s-%s at %s: got %s, want %s", tt.from, tt.to, tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+
+	var q *quietHours
+	if got := q.remaining(at(12, 0)); got != 0 {
+		t.Errorf("expected no quiet hours, got %s", got)
+	}
+}
+
+func TestAlertEscalation(t *testing.T) {
+	uc, n := newTestAlertUseCase(t, escalatingChannels()...)
+
+	if _, err := uc.Alert(context.Background(), "ops", &entity.NotificationMessage{Title: "Leak"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if m := n.next(t); m.Topic != "ops" {
+		t.Fatalf("expected the alert to ops, got %s", m.Topic)
+	}
+	if m := n.next(t); m.Topic != "boss" || m.Title != "Leak" {
+		t.Fatalf("expected the escalation to boss, got %s %s", m.Topic, m.Title)
+	}
+	if len(uc.pending) != 0 {
+		t.Errorf("expected no pending alerts, got %d", len(uc.pending))
+	}
+}
+
+func TestAlertAck(t *testing.T) {
+	uc, n := newTestAlertUseCase(t, escalatingChannels()...)
+
+	id, err := uc.Alert(context.Background(), "ops", &entity.NotificationMessage{Title: "Leak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.next(t)
+
+	if !uc.Ack(id) {
+		t.Fatal("expected the alert to be acknowledged")
+	}
+	n.none(t, 150*time.Millisecond)
+
+	if uc.Ack(id) {
+		t.Error("expected the acknowledged alert to be unknown")
+	}
+}
+
+func TestAlertQuietHours(t *testing.T) {
+	uc, n := newTestAlertUseCase(t,
+		&entity.AlertChannel{Name: "hold", Notify: true, QuietAction: entity.QuietActionHold},
+		&entity.AlertChannel{Name: "drop", Notify: true, QuietAction: entity.QuietActionDrop},
+	)
+
+	// quiet hours from an hour ago to an hour later
+	now := time.Now()
+	minute := now.Hour()*60 + now.Minute()
+	for _, ch := range uc.channels {
+		ch.quiet = &quietHours{from: (minute + 23*60) % (24 * 60), to: (minute + 60) % (24 * 60)}
+	}
+
+	if _, err := uc.Alert(context.Background(), "drop", &entity.NotificationMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	id, err := uc.Alert(context.Background(), "hold", &entity.NotificationMessage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.none(t, 50*time.Millisecond)
+
+	if len(uc.pending) != 1 || uc.pending[id] == nil {
+		t.Fatalf("expected only the held alert to be pending, got %v", uc.pending)
+	}
+	if !uc.Ack(id) {
+		t.Error("expected the held alert to be acknowledged")
+	}
+}
@@ -0,0 +1,159 @@
+package usecase
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+// builtinCommand is the bot command handled by the application, the command is available to users with the role
+type builtinCommand struct {
+	role    entity.BotRole
+	handler func(c *entity.BotCommand) string
+}
+
+var startedAt = time.Now()
+
+func (uc *ScriptUseCase) builtinCommands() map[string]*builtinCommand {
+	return map[string]*builtinCommand{
+		"/status":  {role: entity.BotRoleViewer, handler: uc.statusCommand},
+		"/scripts": {role: entity.BotRoleViewer, handler: uc.scriptsCommand},
+		"/globals": {role: entity.BotRoleViewer, handler: uc.globalsCommand},
+		"/timers":  {role: entity.BotRoleViewer, handler: uc.timersCommand},
+		"/enable":  {role: entity.BotRoleAdmin, handler: uc.scriptCommand(uc.sh.EnableScript, "enabled")},
+		"/disable": {role: entity.BotRoleAdmin, handler: uc.scriptCommand(uc.sh.DisableScript, "disabled")},
+		"/reload":  {role: entity.BotRoleAdmin, handler: uc.scriptCommand(uc.sh.ReloadScript, "reloaded")},
+		"/publish": {role: entity.BotRoleAdmin, handler: uc.publishCommand},
+	}
+}
+
+// runBuiltinCommand runs the built-in command and replies to the chat, false is returned for other commands
+func (uc *ScriptUseCase) runBuiltinCommand(c *entity.BotCommand) bool {
+	cmd, ok := uc.commands[c.Command]
+	if !ok {
+		return false
+	}
+
+	if !uc.allowCommand(c, cmd.role) {
+		return true
+	}
+
+	uc.bot.SendMessage(&entity.BotMessage{Chats: []int64{c.ChatID}, Text: cmd.handler(c), ParseMode: entity.BotParseModePlain})
+
+	return true
+}
+
+// allowCommand reports whether the user has the role, the user is notified if the command is denied
+func (uc *ScriptUseCase) allowCommand(c *entity.BotCommand, role entity.BotRole) bool {
+	if c.Role >= role {
+		return true
+	}
+
+	uc.log.Warn().
+		Int64("user_id", c.UserID).
+		Str("user", c.UserName).
+		Stringer("role", c.Role).
+		Str("command", c.Command).
+		Msg("command is not allowed")
+	uc.bot.SendMessage(&entity.BotMessage{Chats: []int64{c.ChatID}, Text: "Permission denied", ParseMode: entity.BotParseModePlain})
+
+	return false
+}
+
+func (uc *ScriptUseCase) statusCommand(_ *entity.BotCommand) string {
+	st := uc.Status()
+
+	return fmt.Sprintf("Uptime: %s\nMQTT: %s\nScripts: %d loaded, %d disabled, %d failed",
+		st.Uptime,
+		map[bool]string{true: "connected", false: "disconnected"}[st.MQTTConnected],
+		st.Scripts[entity.ScriptStateLoaded],
+		st.Scripts[entity.ScriptStateDisabled],
+		st.Scripts[entity.ScriptStateFailed],
+	)
+}
+
+func (uc *ScriptUseCase) scriptsCommand(_ *entity.BotCommand) string {
+	scripts := uc.sh.Scripts()
+	if len(scripts) == 0 {
+		return "No scripts"
+	}
+
+	lines := make([]string, 0, len(scripts))
+	for _, sc := range scripts {
+		line := fmt.Sprintf("%s (%s) - %s", sc.Name, filepath.Base(sc.Path), sc.State)
+		if len(sc.Error) != 0 {
+			line += ": " + sc.Error
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (uc *ScriptUseCase) globalsCommand(_ *entity.BotCommand) string {
+	globals := uc.sh.Globals()
+	if len(globals) == 0 {
+		return "No global variables"
+	}
+
+	lines := make([]string, 0, len(globals))
+	for _, k := range slices.Sorted(maps.Keys(globals)) {
+		lines = append(lines, k+" = "+globals[k])
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (uc *ScriptUseCase) timersCommand(_ *entity.BotCommand) string {
+	timers := uc.sh.Timers()
+	if len(timers) == 0 {
+		return "No timers"
+	}
+
+	now := time.Now()
+	lines := make([]string, 0, len(timers))
+	for _, t := range timers {
+		next := "-"
+		if !t.Next.IsZero() {
+			next = "in " + t.Next.Sub(now).Round(time.Second).String()
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s %s %s", filepath.Base(t.Script), t.Kind, t.Name, next))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (uc *ScriptUseCase) scriptCommand(f func(name string) error, done string) func(c *entity.BotCommand) string {
+	return func(c *entity.BotCommand) string {
+		if len(c.Args) != 1 {
+			return "Usage: " + c.Command + " <script>"
+		}
+		if err := f(c.Args[0]); err != nil {
+			return fmt.Sprintf("Script %s: %v", c.Args[0], err)
+		}
+		uc.log.Info().Int64("user_id", c.UserID).Str("command", c.Command).Str("script", c.Args[0]).Msg("bot command executed")
+		return fmt.Sprintf("Script %s %s", c.Args[0], done)
+	}
+}
+
+func (uc *ScriptUseCase) publishCommand(c *entity.BotCommand) string {
+	// the payload may contain spaces, so it is taken from the text as is
+	_, args, _ := strings.Cut(strings.TrimSpace(c.Text), " ")
+	topic, payload, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if len(topic) == 0 || len(payload) == 0 {
+		return "Usage: /publish <topic> <payload>"
+	}
+
+	if err := uc.publish(topic, []byte(payload)); err != nil {
+		return fmt.Sprintf("Failed to publish: %v", err)
+	}
+
+	uc.log.Info().Int64("user_id", c.UserID).Str("topic", topic).Str("payload", payload).Msg("bot command executed")
+
+	return "Published to " + topic
+}
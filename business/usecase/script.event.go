@@ -1,43 +1,124 @@
 package usecase
 
+import (
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/metrics"
+)
+
 func (uc *ScriptUseCase) subscribeEventHandler() {
-	go func() {
-		for {
-			select {
-			case <-uc.ctx.Done():
-				return
-			case e, ok := <-uc.subscribeCh:
-				if !ok {
-					return
-				}
-				uc.subscribers.add(e.Topic, e.Script, func() {
-					if err := uc.mqtt.Subscribe(e.Topic, uc.mqttMessage); err != nil {
-						uc.log.Fatalf("failed to subscribe to topic %s: %v", e.Topic, err)
-					}
-					uc.log.Info().Str("topic", e.Topic).Msg("subscribed to topic")
-				})
+	eventLoop(uc, "subscribe", uc.subscribeCh, func(e *entity.SubscribeEvent) {
+		uc.subscribers.add(e.Topic, e.Script, e.NoRetained, func() {
+			if err := uc.mqtt.Subscribe(e.Topic, uc.mqttMessage); err != nil {
+				uc.log.Fatalf("failed to subscribe to topic %s: %v", e.Topic, err)
 			}
+			uc.log.Info().Str("topic", e.Topic).Msg("subscribed to topic")
+		})
+	})
+}
+
+func (uc *ScriptUseCase) notifySubscribeEventHandler() {
+	eventLoop(uc, "notify_subscribe", uc.notifySubscribeCh, func(e *entity.NotifySubscribeEvent) {
+		if uc.notifySubscriber == nil {
+			uc.log.Error().Str("topic", e.Topic).Str("script", e.Script.Path()).Msg("notifications are disabled")
+			return
 		}
-	}()
+		exists := uc.notifySubscribers.has(e.Topic)
+		uc.notifySubscribers.add(e.Topic, e.Script, false, func() {
+			// one stream per topic is shared by all scripts
+			if !exists {
+				uc.notifySubscriber.Subscribe(e.Topic, uc.notifyMessage)
+			}
+		})
+	})
+}
+
+func (uc *ScriptUseCase) botCommandEventHandler() {
+	eventLoop(uc, "bot_command", uc.botCommandCh, func(e *entity.BotCommandEvent) {
+		if uc.botSubscriber == nil {
+			uc.log.Error().Str("command", e.Command).Str("script", e.Script.Path()).Msg("bot is disabled")
+			return
+		}
+		uc.botCommands.add(e.Command, e.Script, false, func() {
+			uc.log.Info().Str("command", e.Command).Str("script", e.Script.Path()).Msg("subscribed to bot command")
+		})
+	})
+}
+
+// unsubscribeEventHandler removes the unloaded script from all subscribers, the topics stay subscribed
+// because the MQTT subscriptions and the notification streams are shared by the scripts
+func (uc *ScriptUseCase) unsubscribeEventHandler() {
+	eventLoop(uc, "unsubscribe", uc.unsubscribeCh, func(e *entity.UnsubscribeEvent) {
+		uc.subscribers.remove(e.Script)
+		uc.notifySubscribers.remove(e.Script)
+		uc.botCommands.remove(e.Script)
+		uc.log.Debug().Str("script", e.Script.Path()).Msg("script unsubscribed")
+	})
 }
 
 func (uc *ScriptUseCase) publishEventHandler() {
+	eventLoop(uc, "publish", uc.publishCh, func(e *entity.PublishEvent) {
+		if err := uc.publish(e.Topic, []byte(e.Payload)); err != nil {
+			uc.log.Error().Err(err).
+				Str("topic", e.Topic).
+				Interface("payload", e.Payload).
+				Msg("failed to publish event")
+		}
+	})
+}
+
+func (uc *ScriptUseCase) requestEventHandler() {
+	eventLoop(uc, "request", uc.requestCh, func(e *entity.RequestEvent) {
+		if err := uc.mqtt.Subscribe(e.ResponseTopic, uc.mqttMessage); err != nil {
+			uc.log.Error().Err(err).
+				Str("topic", e.ResponseTopic).
+				Msg("failed to subscribe to response topic")
+			return
+		}
+
+		uc.requests.add(e)
+
+		if err := uc.publish(e.Topic, []byte(e.Payload)); err != nil {
+			uc.log.Error().Err(err).
+				Str("topic", e.Topic).
+				Interface("payload", e.Payload).
+				Msg("failed to publish request")
+		}
+	})
+}
+
+// eventLoop calls the handler for every event of the channel until the context is done,
+// the loop beats after every event and every heartbeatInterval while it is idle
+func eventLoop[T any](uc *ScriptUseCase, name string, ch <-chan T, handler func(e T)) {
+	hb := uc.heartbeats.add(name)
+
 	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
 		for {
+			hb.Store(time.Now().UnixNano())
+
 			select {
 			case <-uc.ctx.Done():
 				return
-			case e, ok := <-uc.publishCh:
+			case <-ticker.C:
+			case e, ok := <-ch:
 				if !ok {
 					return
 				}
-				if err := uc.mqtt.Publish(e.Topic, []byte(e.Payload)); err != nil {
-					uc.log.Error().Err(err).
-						Str("topic", e.Topic).
-						Interface("payload", e.Payload).
-						Msg("failed to publish event")
-				}
+				handler(e)
 			}
 		}
 	}()
 }
+
+// publish publishes the message and counts it per the topic prefix
+func (uc *ScriptUseCase) publish(topic string, payload []byte) error {
+	if err := uc.mqtt.Publish(topic, payload); err != nil {
+		return err
+	}
+	metrics.MQTTPublished.WithLabelValues(metrics.TopicPrefix(topic)).Inc()
+	return nil
+}
@@ -3,45 +3,91 @@ package usecase
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/forest33/honeybee/business/entity"
 	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/metrics"
 )
 
 const (
 	eventsChannelCapacity = 100
+	botCommandAll         = "*"
 )
 
 type ScriptUseCase struct {
-	ctx         context.Context
-	cfg         *entity.Config
-	log         *logger.Logger
-	mqtt        MqttClient
-	sh          ScriptHandler
-	subscribeCh chan *entity.SubscribeEvent
-	publishCh   chan *entity.PublishEvent
-	subscribers *subscribers
+	ctx               context.Context
+	cfg               *entity.Config
+	log               *logger.Logger
+	mqtt              MqttClient
+	sh                ScriptHandler
+	subscribeCh       chan *entity.SubscribeEvent
+	publishCh         chan *entity.PublishEvent
+	requestCh         chan *entity.RequestEvent
+	notifySubscribeCh chan *entity.NotifySubscribeEvent
+	botCommandCh      chan *entity.BotCommandEvent
+	unsubscribeCh     chan *entity.UnsubscribeEvent
+	subscribers       *subscribers
+	notifySubscribers *subscribers
+	notifySubscriber  entity.NotificationSubscriber
+	botCommands       *subscribers
+	bot               entity.BotHandler
+	botSubscriber     entity.BotSubscriber
+	commands          map[string]*builtinCommand
+	requests          *requests
+	heartbeats        heartbeats
 }
 
-func NewScriptUseCase(ctx context.Context, cfg *entity.Config, log *logger.Logger, mqtt MqttClient, sh ScriptHandler, bot entity.BotHandler, notify entity.NotificationHandler) (*ScriptUseCase, error) {
+func NewScriptUseCase(ctx context.Context, cfg *entity.Config, log *logger.Logger, mqtt MqttClient, sh ScriptHandler, sched Scheduler, bot entity.BotHandler, botSubscriber entity.BotSubscriber, notify entity.NotificationHandler, notifySubscriber entity.NotificationSubscriber, alert entity.AlertHandler) (*ScriptUseCase, error) {
 	uc := &ScriptUseCase{
-		ctx:         ctx,
-		cfg:         cfg,
-		log:         log,
-		mqtt:        mqtt,
-		sh:          sh,
-		subscribeCh: make(chan *entity.SubscribeEvent, eventsChannelCapacity),
-		publishCh:   make(chan *entity.PublishEvent, eventsChannelCapacity),
-		subscribers: newSubscribers(),
+		ctx:               ctx,
+		cfg:               cfg,
+		log:               log,
+		mqtt:              mqtt,
+		sh:                sh,
+		subscribeCh:       make(chan *entity.SubscribeEvent, eventsChannelCapacity),
+		publishCh:         make(chan *entity.PublishEvent, eventsChannelCapacity),
+		requestCh:         make(chan *entity.RequestEvent, eventsChannelCapacity),
+		notifySubscribeCh: make(chan *entity.NotifySubscribeEvent, eventsChannelCapacity),
+		botCommandCh:      make(chan *entity.BotCommandEvent, eventsChannelCapacity),
+		unsubscribeCh:     make(chan *entity.UnsubscribeEvent, eventsChannelCapacity),
+		subscribers:       newSubscribers(),
+		notifySubscribers: newSubscribers(),
+		notifySubscriber:  notifySubscriber,
+		botCommands:       newSubscribers(),
+		bot:               bot,
+		botSubscriber:     botSubscriber,
+		requests:          newRequests(),
+		heartbeats:        make(heartbeats),
 	}
 
 	uc.sh.SetSubscribeChannel(uc.subscribeCh)
 	uc.sh.SetPublishChannel(uc.publishCh)
+	uc.sh.SetRequestChannel(uc.requestCh)
+	uc.sh.SetNotifySubscribeChannel(uc.notifySubscribeCh)
+	uc.sh.SetBotCommandChannel(uc.botCommandCh)
+	uc.sh.SetUnsubscribeChannel(uc.unsubscribeCh)
 	uc.sh.SetBotHandler(bot)
 	uc.sh.SetNotificationHandler(notify)
+	uc.sh.SetAlertHandler(alert)
+
+	if sched != nil {
+		uc.sh.SetScheduler(sched)
+		sched.SetDeadLetterHandler(uc.sh.SendDeadLetterEvent)
+	}
 
 	uc.subscribeEventHandler()
 	uc.publishEventHandler()
+	uc.requestEventHandler()
+	uc.notifySubscribeEventHandler()
+	uc.botCommandEventHandler()
+	uc.unsubscribeEventHandler()
+
+	if botSubscriber != nil {
+		uc.commands = uc.builtinCommands()
+		botSubscriber.SubscribeCallbacks(uc.botCallback)
+		botSubscriber.SubscribeCommands(uc.botCommand)
+	}
 
 	wgConnect := &sync.WaitGroup{}
 	wgConnect.Add(1)
@@ -63,10 +109,87 @@ func NewScriptUseCase(ctx context.Context, cfg *entity.Config, log *logger.Logge
 func (uc *ScriptUseCase) mqttMessage(m entity.MQTTMessage) {
 	uc.log.Debug().Str("topic", m.Topic()).Str("payload", string(m.Payload())).Msg("MQTT message")
 
-	scripts := uc.subscribers.getScriptsByTopic(m.Topic())
+	metrics.MQTTReceived.WithLabelValues(metrics.TopicPrefix(m.Topic())).Inc()
+
+	uc.requests.resolve(m)
+
+	scripts := uc.subscribers.getScriptsByTopic(m.Topic(), m.Retained())
+	if len(scripts) == 0 {
+		return
+	}
+
+	uc.sh.SendMessageEvent(scripts, m)
+}
+
+func (uc *ScriptUseCase) notifyMessage(m *entity.ReceivedNotification) {
+	uc.log.Debug().Str("topic", m.Topic).Str("message", m.Message).Msg("notification message")
+
+	scripts := uc.notifySubscribers.getScriptsByTopic(m.Topic, false)
+	if len(scripts) == 0 {
+		return
+	}
+
+	uc.sh.SendNotifyEvent(scripts, m)
+}
+
+// botCommand runs the built-in command or passes the command to the scripts which declared it, messages without
+// a command and commands which are not declared are passed to the scripts subscribed to all messages
+func (uc *ScriptUseCase) botCommand(c *entity.BotCommand) {
+	uc.log.Debug().Int64("chat_id", c.ChatID).Str("command", c.Command).Strs("args", c.Args).Msg("bot command")
+
+	if uc.runBuiltinCommand(c) {
+		return
+	}
+
+	if c.Role < entity.BotRoleUser {
+		// plain text of viewers is ignored silently
+		if len(c.Command) != 0 {
+			uc.allowCommand(c, entity.BotRoleUser)
+		}
+		return
+	}
+
+	scripts := uc.botCommands.getScriptsByTopic(c.Command, false)
+	if len(c.Command) == 0 || len(scripts) == 0 {
+		scripts = append(scripts, uc.botCommands.getScriptsByTopic(botCommandAll, false)...)
+	}
+
 	if len(scripts) == 0 {
+		if len(c.Command) != 0 {
+			uc.bot.SendMessage(&entity.BotMessage{Chats: []int64{c.ChatID}, Text: "Unknown command " + c.Command, ParseMode: entity.BotParseModePlain})
+		}
 		return
 	}
 
-	uc.sh.SendMessageEvent(scripts, m.Topic(), m.Data())
+	uc.sh.SendBotCommandEvent(scripts, c)
+}
+
+// botCallback passes the callback query to all scripts, the scripts recognize their buttons by the callback data
+func (uc *ScriptUseCase) botCallback(c *entity.BotCallback) {
+	uc.log.Debug().Int64("chat_id", c.ChatID).Int("message_id", c.MessageID).Str("data", c.Data).Msg("bot callback")
+
+	uc.sh.SendBotCallbackEvent(c)
+}
+
+// Status returns the uptime, the MQTT connection state and the number of scripts per state
+func (uc *ScriptUseCase) Status() *entity.Status {
+	st := &entity.Status{
+		StartedAt:     startedAt,
+		Uptime:        time.Since(startedAt).Round(time.Second).String(),
+		MQTTConnected: uc.mqtt.IsConnected(),
+		Scripts:       make(map[string]int),
+	}
+	for _, sc := range uc.sh.Scripts() {
+		st.Scripts[sc.State]++
+	}
+	return st
+}
+
+// Subscriptions returns the scripts subscribed to MQTT topics, ntfy topics and bot commands
+func (uc *ScriptUseCase) Subscriptions() *entity.Subscriptions {
+	return &entity.Subscriptions{
+		MQTT:     uc.subscribers.getAll(),
+		Notify:   uc.notifySubscribers.getAll(),
+		Commands: uc.botCommands.getAll(),
+	}
 }
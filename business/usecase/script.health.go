@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+const (
+	heartbeatInterval = 10 * time.Second
+	loopDeadline      = time.Minute // the event loop which doesn't beat longer is stuck
+)
+
+// heartbeats keeps the time of the last beat of every event loop in unix nanoseconds,
+// loops are added before they are started
+type heartbeats map[string]*atomic.Int64
+
+func (h heartbeats) add(name string) *atomic.Int64 {
+	hb := &atomic.Int64{}
+	hb.Store(time.Now().UnixNano())
+	h[name] = hb
+	return hb
+}
+
+// Liveness checks that the event loops are not stuck
+func (uc *ScriptUseCase) Liveness() *entity.Health {
+	problems := make([]string, 0)
+
+	names := make([]string, 0, len(uc.heartbeats))
+	for name := range uc.heartbeats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if since := time.Since(time.Unix(0, uc.heartbeats[name].Load())); since > loopDeadline {
+			problems = append(problems, fmt.Sprintf("event loop %s is stuck for %s", name, since.Round(time.Second)))
+		}
+	}
+
+	return newHealth(problems)
+}
+
+// Readiness checks the liveness, the MQTT connection, that all scripts are loaded
+// and no script event handler runs longer than the deadline
+func (uc *ScriptUseCase) Readiness() *entity.Health {
+	problems := uc.Liveness().Problems
+
+	if !uc.mqtt.IsConnected() {
+		problems = append(problems, "MQTT is not connected")
+	}
+
+	deadline := time.Duration(uc.cfg.Scripts.HandlerDeadline) * time.Second
+	for _, sc := range uc.sh.Scripts() {
+		switch {
+		case sc.State == entity.ScriptStateFailed:
+			problems = append(problems, fmt.Sprintf("script %s failed to load: %s", sc.Path, sc.Error))
+		case deadline > 0 && sc.BusySince != nil && time.Since(*sc.BusySince) > deadline:
+			problems = append(problems, fmt.Sprintf("script %s is stuck in the event handler for %s",
+				sc.Path, time.Since(*sc.BusySince).Round(time.Second)))
+		}
+	}
+
+	return newHealth(problems)
+}
+
+func newHealth(problems []string) *entity.Health {
+	return &entity.Health{
+		OK:       len(problems) == 0,
+		Problems: problems,
+	}
+}
@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+type requests struct {
+	data []*entity.RequestEvent
+	sync.Mutex
+}
+
+func newRequests() *requests {
+	return &requests{
+		data: make([]*entity.RequestEvent, 0, 1),
+	}
+}
+
+func (r *requests) add(e *entity.RequestEvent) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.data = append(r.data, e)
+}
+
+// resolve sends the message to the first pending request waiting for it, expired requests are removed.
+// Retained messages are not responses, they are sent by the broker when the response topic is subscribed.
+func (r *requests) resolve(m entity.MQTTMessage) {
+	if m.Retained() {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	resolved := false
+
+	r.data = slices.DeleteFunc(r.data, func(e *entity.RequestEvent) bool {
+		if now.After(e.Deadline) {
+			return true
+		}
+		if resolved || !topicMatches(e.ResponseTopic, m.Topic()) || (e.Match != nil && !e.Match(m)) {
+			return false
+		}
+		resolved = true
+		e.Response <- m
+		return true
+	})
+}
+
+// topicMatches reports whether the topic matches the MQTT topic filter with the + and # wildcards,
+// the filters starting with a wildcard don't match the topics starting with $
+func topicMatches(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		switch {
+		case f == "#":
+			return true
+		case i >= len(tl):
+			return false
+		case f != "+" && f != tl[i]:
+			return false
+		}
+	}
+
+	return len(fl) == len(tl)
+}
@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/forest33/honeybee/business/entity"
+)
+
+type testMessage struct {
+	topic    string
+	retained bool
+}
+
+func (m *testMessage) Topic() string                { return m.topic }
+func (m *testMessage) Payload() []byte              { return nil }
+func (m *testMessage) Data() map[string]interface{} { return nil }
+func (m *testMessage) Retained() bool               { return m.retained }
+func (m *testMessage) QoS() byte                    { return 0 }
+func (m *testMessage) Duplicate() bool              { return false }
+func (m *testMessage) MessageID() uint16            { return 0 }
+func (m *testMessage) ReceivedAt() time.Time        { return time.Time{} }
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"device/state", "device/state", true},
+		{"device/state", "device/status", false},
+		{"device/state", "device/state/1", false},
+		{"device/+/state", "device/1/state", true},
+		{"device/+/state", "device/1/2/state", false},
+		{"device/+", "device/", true},
+		{"device/#", "device/1/state", true},
+		{"device/#", "device", true},
+		{"device/#", "other/1", false},
+		{"#", "device/1", true},
+		{"+/state", "device/state", true},
+		{"#", "$SYS/broker", false},
+		{"+/broker", "$SYS/broker", false},
+		{"$SYS/#", "$SYS/broker", true},
+	}
+
+	for _, tt := range tests {
+		if got := topicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestRequestsResolve(t *testing.T) {
+	r := newRequests()
+	e := &entity.RequestEvent{
+		ResponseTopic: "device/+/response",
+		Deadline:      time.Now().Add(time.Minute),
+		Response:      make(chan entity.MQTTMessage, 1),
+	}
+	r.add(e)
+
+	r.resolve(&testMessage{topic: "device/1/response", retained: true})
+	r.resolve(&testMessage{topic: "device/1/state"})
+	select {
+	case m := <-e.Response:
+		t.Fatalf("unexpected response %s", m.Topic())
+	default:
+	}
+
+	r.resolve(&testMessage{topic: "device/1/response"})
+	select {
+	case m := <-e.Response:
+		if m.Topic() != "device/1/response" {
+			t.Fatalf("unexpected response %s", m.Topic())
+		}
+	default:
+		t.Fatal("request is not resolved")
+	}
+
+	if len(r.data) != 0 {
+		t.Fatalf("resolved request is not removed")
+	}
+}
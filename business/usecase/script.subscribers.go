@@ -1,6 +1,8 @@
 package usecase
 
 import (
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/forest33/honeybee/business/entity"
@@ -8,30 +10,49 @@ import (
 )
 
 type subscribers struct {
-	data map[string]map[string]struct{}
+	data map[string]map[string]*subscription
 	sync.RWMutex
 }
 
+type subscription struct {
+	script     entity.Script
+	noRetained bool
+}
+
 func newSubscribers() *subscribers {
 	return &subscribers{
-		data: make(map[string]map[string]struct{}),
+		data: make(map[string]map[string]*subscription),
 	}
 }
 
-func (s *subscribers) add(topic string, script entity.Script, handler func()) {
+func (s *subscribers) add(topic string, script entity.Script, noRetained bool, handler func()) {
 	s.Lock()
 	defer s.Unlock()
 
 	if _, ok := s.data[topic]; !ok {
-		s.data[topic] = make(map[string]struct{}, 1)
+		s.data[topic] = make(map[string]*subscription, 1)
 	}
 
-	s.data[topic][script.Path()] = struct{}{}
+	s.data[topic][script.Path()] = &subscription{script: script, noRetained: noRetained}
 
 	handler()
 }
 
-func (s *subscribers) getScriptsByTopic(topic string) []string {
+// remove removes the subscriptions of the script, the subscriptions of the script reloaded from the same path
+// are kept, the topics are kept as well because they stay subscribed
+func (s *subscribers) remove(script entity.Script) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, scripts := range s.data {
+		if sub, ok := scripts[script.Path()]; ok && sub.script == script {
+			delete(scripts, script.Path())
+		}
+	}
+}
+
+// getScriptsByTopic returns scripts subscribed to the topic, retained messages are not delivered to the scripts that opted out of them
+func (s *subscribers) getScriptsByTopic(topic string, retained bool) []string {
 	s.RLock()
 	defer s.RUnlock()
 
@@ -39,7 +60,22 @@ func (s *subscribers) getScriptsByTopic(topic string) []string {
 		return nil
 	}
 
-	return structs.Keys(s.data[topic])
+	if !retained {
+		return structs.Keys(s.data[topic])
+	}
+
+	return structs.Keys(structs.FilterMap(s.data[topic], func(sub *subscription) bool {
+		return !sub.noRetained
+	}))
+}
+
+// has reports whether the topic has ever been subscribed
+func (s *subscribers) has(topic string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.data[topic]
+	return ok
 }
 
 func (s *subscribers) getTopics() []string {
@@ -48,3 +84,18 @@ func (s *subscribers) getTopics() []string {
 
 	return structs.Keys(s.data)
 }
+
+// getAll returns paths of the subscribed scripts per topic, the topics without scripts are skipped
+func (s *subscribers) getAll() map[string][]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	all := make(map[string][]string, len(s.data))
+	for topic, scripts := range s.data {
+		if len(scripts) != 0 {
+			all[topic] = slices.Sorted(maps.Keys(scripts))
+		}
+	}
+
+	return all
+}
@@ -0,0 +1,44 @@
+package usecase
+
+import (
+	"slices"
+	"testing"
+)
+
+type testScript struct {
+	path string
+}
+
+func (s *testScript) Path() string { return s.path }
+func (s *testScript) Name() string { return s.path }
+
+func TestSubscribersRemove(t *testing.T) {
+	s := newSubscribers()
+	first, other := &testScript{path: "a.lua"}, &testScript{path: "b.lua"}
+	s.add("topic/1", first, false, func() {})
+	s.add("topic/2", first, false, func() {})
+	s.add("topic/2", other, false, func() {})
+
+	s.remove(first)
+
+	if scripts := s.getScriptsByTopic("topic/1", false); len(scripts) != 0 {
+		t.Fatalf("removed script is subscribed: %v", scripts)
+	}
+	if scripts := s.getScriptsByTopic("topic/2", false); !slices.Equal(scripts, []string{"b.lua"}) {
+		t.Fatalf("unexpected scripts %v", scripts)
+	}
+	if !s.has("topic/1") {
+		t.Fatal("topic without scripts is removed")
+	}
+	if _, ok := s.getAll()["topic/1"]; ok {
+		t.Fatal("topic without scripts is reported")
+	}
+
+	// the unsubscribe event of the previous instance may arrive after the reloaded script is subscribed
+	reloaded := &testScript{path: "b.lua"}
+	s.add("topic/2", reloaded, false, func() {})
+	s.remove(other)
+	if scripts := s.getScriptsByTopic("topic/2", false); !slices.Equal(scripts, []string{"b.lua"}) {
+		t.Fatalf("reloaded script is removed: %v", scripts)
+	}
+}
@@ -3,6 +3,7 @@ package usecase
 import (
 	"github.com/forest33/honeybee/adapter/mqtt"
 	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/scheduler"
 )
 
 type MqttClient interface {
@@ -10,14 +11,36 @@ type MqttClient interface {
 	Publish(topic string, payload []byte) error
 	Subscribe(topic string, handler mqtt.MessageHandler) error
 	SetConnectHandler(h mqtt.ConnectHandler)
+	IsConnected() bool
 	Close()
 }
 
 type ScriptHandler interface {
 	Start() error
-	SendMessageEvent(script []string, topic string, payload map[string]interface{})
+	SendMessageEvent(script []string, m entity.MQTTMessage)
 	SetSubscribeChannel(ch chan *entity.SubscribeEvent)
 	SetPublishChannel(ch chan *entity.PublishEvent)
+	SetRequestChannel(ch chan *entity.RequestEvent)
+	SetNotifySubscribeChannel(ch chan *entity.NotifySubscribeEvent)
+	SendNotifyEvent(script []string, m *entity.ReceivedNotification)
+	SetBotCommandChannel(ch chan *entity.BotCommandEvent)
+	SetUnsubscribeChannel(ch chan *entity.UnsubscribeEvent)
+	SendBotCommandEvent(script []string, c *entity.BotCommand)
+	SendBotCallbackEvent(c *entity.BotCallback)
 	SetBotHandler(bot entity.BotHandler)
 	SetNotificationHandler(notify entity.NotificationHandler)
+	SetAlertHandler(alert entity.AlertHandler)
+	SetScheduler(sched entity.SchedulerHandler)
+	SendDeadLetterEvent(dl *scheduler.DeadLetter)
+	Scripts() []*entity.ScriptInfo
+	EnableScript(name string) error
+	DisableScript(name string) error
+	ReloadScript(name string) error
+	Globals() map[string]string
+	Timers() []*entity.TimerInfo
+}
+
+type Scheduler interface {
+	entity.SchedulerHandler
+	SetDeadLetterHandler(h scheduler.DeadLetterHandler)
 }
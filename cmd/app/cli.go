@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/forest33/honeybee/adapter/api"
+	"github.com/forest33/honeybee/business/entity"
+	"github.com/forest33/honeybee/pkg/structs"
+)
+
+const usage = `Usage:
+  honeybee                                              run the application
+  honeybee script list                                  list scripts
+  honeybee script enable|disable|reload <script>        change the script state
+  honeybee script call <script> <function> [args...]    call the function, arguments are JSON values or strings
+  honeybee script inject [-retained] <script> <topic> <payload>
+                                                        pass the MQTT message to OnMessage of the script
+  honeybee healthcheck [-ready]                         check the liveness or the readiness, exits with 1 on failure
+`
+
+// runCommand runs the command of the command line interface through the API of the running application
+func runCommand(cfg *entity.Config, args []string) error {
+	switch {
+	case args[0] == "healthcheck":
+	case args[0] == "script" && len(args) > 1:
+	default:
+		return errors.New(usage)
+	}
+	// the health checks are served if the API is disabled and API.Health is set
+	if !cfg.API.Enabled && args[0] == "healthcheck" && !cfg.API.Health {
+		return errors.New("neither the API nor API.Health is enabled in the configuration file")
+	}
+	if !cfg.API.Enabled && args[0] != "healthcheck" {
+		return errors.New("the API section of the configuration file is not enabled")
+	}
+
+	client := api.NewClient(&api.Config{
+		Listen:  cfg.API.Listen,
+		Timeout: time.Duration(cfg.API.Timeout) * time.Second,
+		Token:   cfg.API.Token,
+	})
+	ctx := context.Background()
+
+	if args[0] == "healthcheck" {
+		return healthcheck(ctx, client, args[1:])
+	}
+
+	switch cmd, args := args[1], args[2:]; cmd {
+	case "list":
+		return listScripts(ctx, client)
+	case "enable", "disable", "reload":
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		if err := client.Do(ctx, http.MethodPost, scriptPath(args[0], cmd), nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("script %s %s\n", args[0], map[string]string{"enable": "enabled", "disable": "disabled", "reload": "reloaded"}[cmd])
+		return nil
+	case "call":
+		if len(args) < 2 {
+			return errors.New(usage)
+		}
+		return callFunction(ctx, client, args[0], args[1], args[2:])
+	case "inject":
+		return injectMessage(ctx, client, args)
+	default:
+		return errors.New(usage)
+	}
+}
+
+func listScripts(ctx context.Context, client *api.Client) error {
+	var scripts []*entity.ScriptInfo
+	if err := client.Do(ctx, http.MethodGet, "/api/scripts", nil, &scripts); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tPATH\tERROR")
+	for _, sc := range scripts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", sc.Name, sc.State, sc.Path, sc.Error)
+	}
+
+	return w.Flush()
+}
+
+func callFunction(ctx context.Context, client *api.Client, name, fn string, args []string) error {
+	params := make([]json.RawMessage, 0, len(args))
+	for _, a := range args {
+		if !json.Valid([]byte(a)) {
+			a = fmt.Sprintf("%q", a)
+		}
+		params = append(params, json.RawMessage(a))
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	resp := &api.CallResponse{}
+	if err := client.Do(ctx, http.MethodPost, scriptPath(name, "call"), &api.CallRequest{Function: fn, Args: data}, resp); err != nil {
+		return err
+	}
+
+	fmt.Println(string(resp.Result))
+
+	return nil
+}
+
+func injectMessage(ctx context.Context, client *api.Client, args []string) error {
+	fs := flag.NewFlagSet("inject", flag.ContinueOnError)
+	retained := fs.Bool("retained", false, "the message is retained")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		return errors.New(usage)
+	}
+
+	payload, err := json.Marshal(fs.Arg(2))
+	if err != nil {
+		return err
+	}
+
+	return client.Do(ctx, http.MethodPost, scriptPath(fs.Arg(0), "inject"), &api.InjectRequest{
+		Topic:    fs.Arg(1),
+		Payload:  payload,
+		Retained: *retained,
+	}, nil)
+}
+
+func healthcheck(ctx context.Context, client *api.Client, args []string) error {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	ready := fs.Bool("ready", false, "check the readiness instead of the liveness")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	h, err := client.Health(ctx, structs.If(*ready, api.ReadyPath, api.HealthPath))
+	if err != nil {
+		return err
+	}
+	if !h.OK {
+		return errors.New(strings.Join(h.Problems, "\n"))
+	}
+
+	fmt.Println("OK")
+
+	return nil
+}
+
+func scriptPath(name, op string) string {
+	return "/api/scripts/" + url.PathEscape(name) + "/" + op
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/forest33/honeybee/adapter/api"
 	"github.com/forest33/honeybee/adapter/bot"
+	"github.com/forest33/honeybee/adapter/bridge"
+	"github.com/forest33/honeybee/adapter/broker"
 	"github.com/forest33/honeybee/adapter/mqtt"
 	"github.com/forest33/honeybee/adapter/notification"
 	"github.com/forest33/honeybee/adapter/script"
@@ -17,7 +21,9 @@ import (
 	"github.com/forest33/honeybee/pkg/automaxprocs"
 	"github.com/forest33/honeybee/pkg/codec"
 	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/ratelimit"
 	"github.com/forest33/honeybee/pkg/scheduler"
+	"github.com/forest33/honeybee/pkg/structs"
 )
 
 func main() {
@@ -34,6 +40,14 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	l := logger.New(logger.Config{
 		Level:             cfg.Logger.Level,
 		TimeFormat:        cfg.Logger.TimeFormat,
@@ -47,56 +61,177 @@ func main() {
 		l.Fatal(err)
 	}
 
-	mqttClient, err := mqtt.New(ctx, &mqtt.Config{
-		Host:                 cfg.MQTT.Host,
-		Port:                 cfg.MQTT.Port,
-		ClientID:             cfg.MQTT.ClientID,
-		User:                 cfg.MQTT.User,
-		Password:             cfg.MQTT.Password,
-		UseTLS:               cfg.MQTT.UseTLS,
-		ServerTLS:            cfg.MQTT.ServerTLS,
-		CACert:               cfg.MQTT.CACert,
-		Cert:                 cfg.MQTT.Cert,
-		Key:                  cfg.MQTT.Key,
-		InsecureSkipVerify:   false,
-		ConnectRetryInterval: time.Duration(cfg.MQTT.ConnectRetryInterval) * time.Second,
-		Timeout:              time.Duration(cfg.MQTT.Timeout) * time.Second,
-	}, l, codec.NewFastJsonCodec())
+	var mqttClient usecase.MqttClient
+	if cfg.Broker.Enabled {
+		mqttClient, err = broker.New(ctx, &broker.Config{
+			Listeners: structs.Map(cfg.Broker.Listeners, func(l *entity.BrokerListener) broker.Listener {
+				return broker.Listener{Type: l.Type, Address: l.Address}
+			}),
+			AuthFile:  cfg.Broker.AuthFile,
+			StorePath: cfg.Broker.StorePath,
+		}, l, codec.NewFastJsonCodec())
+	} else {
+		mqttClient, err = mqtt.New(ctx, &mqtt.Config{
+			Host:                 cfg.MQTT.Host,
+			Port:                 cfg.MQTT.Port,
+			ClientID:             cfg.MQTT.ClientID,
+			User:                 cfg.MQTT.User,
+			Password:             cfg.MQTT.Password,
+			UseTLS:               cfg.MQTT.UseTLS,
+			ServerTLS:            cfg.MQTT.ServerTLS,
+			CACert:               cfg.MQTT.CACert,
+			Cert:                 cfg.MQTT.Cert,
+			Key:                  cfg.MQTT.Key,
+			InsecureSkipVerify:   false,
+			ConnectRetryInterval: time.Duration(cfg.MQTT.ConnectRetryInterval) * time.Second,
+			Timeout:              time.Duration(cfg.MQTT.Timeout) * time.Second,
+		}, l, codec.NewFastJsonCodec())
+	}
 	if err != nil {
 		l.Fatal(err)
 	}
 
-	var sched *scheduler.Scheduler
+	var (
+		sched         usecase.Scheduler
+		taskScheduler *scheduler.Scheduler
+	)
 	if cfg.Scheduler.Enabled {
-		sched = scheduler.New(&scheduler.Config{
+		var store scheduler.Store
+		if len(cfg.Scheduler.StorePath) != 0 {
+			if store, err = scheduler.NewFileStore(cfg.Scheduler.StorePath); err != nil {
+				l.Fatal(err)
+			}
+		}
+		taskScheduler = scheduler.New(&scheduler.Config{
 			MaxTasksPerSender: cfg.Scheduler.MaxTasksPerSender,
+			MaxAttempts:       cfg.Scheduler.MaxAttempts,
+			MaxProcessingTime: time.Duration(cfg.Scheduler.MaxProcessingTime) * time.Second,
+			Backoff: scheduler.Backoff{
+				Delay:      time.Duration(cfg.Scheduler.Delay * float64(time.Second)),
+				Multiplier: cfg.Scheduler.Multiplier,
+				MaxDelay:   time.Duration(cfg.Scheduler.MaxDelay * float64(time.Second)),
+				Jitter:     scheduler.Jitter(cfg.Scheduler.Jitter),
+			},
+			DeadLetterSize: cfg.Scheduler.DeadLetterSize,
+			Store:          store,
 		}, l)
+		sched = taskScheduler
 	}
 
-	var tgBot *bot.Bot
+	limiter := ratelimit.New(ratelimit.Config{
+		Rate:     cfg.RateLimit.Rate,
+		Burst:    cfg.RateLimit.Burst,
+		Interval: time.Duration(cfg.RateLimit.Interval * float64(time.Second)),
+	})
+
+	var (
+		botHandler    entity.BotHandler
+		botSubscriber entity.BotSubscriber
+	)
 	if cfg.Bot.Enabled {
-		tgBot, err = bot.New(ctx, &bot.Config{
+		tgBot, err := bot.New(ctx, &bot.Config{
 			Token:         cfg.Bot.Token,
 			ChatId:        cfg.Bot.ChatId,
 			UpdateTimeout: cfg.Bot.UpdateTimeout,
 			PoolSize:      cfg.Bot.PoolSize,
-		}, l, sched)
+			MaxFileSize:   int64(cfg.Bot.MaxFileSize) << 20,
+			ParseMode:     cfg.Bot.ParseMode,
+			APIEndpoint:   cfg.Bot.APIEndpoint,
+			Admins:        cfg.Bot.Admins,
+			Users: structs.Map(cfg.Bot.Users, func(u *entity.BotUser) bot.User {
+				return bot.User{
+					Id:   u.Id,
+					Role: u.Role,
+				}
+			}),
+			ReportUnauthorized: cfg.Bot.ReportUnauthorized,
+			LiveMessagesFile:   cfg.Bot.LiveMessagesFile,
+			Groups: structs.Map(cfg.Bot.Groups, func(g *entity.BotGroup) bot.Group {
+				return bot.Group{
+					Name:   g.Name,
+					ChatId: g.ChatId,
+				}
+			}),
+		}, l, sched, limiter)
 		if err != nil {
 			l.Fatal(err)
 		}
+		botHandler = tgBot
+		botSubscriber = tgBot
 	}
 
-	var notifyClient *notification.Client
+	var (
+		notifyHandler    entity.NotificationHandler
+		notifySubscriber entity.NotificationSubscriber
+	)
 	if cfg.Notification.Enabled {
-		notifyClient, err = notification.New(ctx, &notification.Config{
-			BaseURL:  cfg.Notification.BaseURL,
-			Timeout:  time.Duration(cfg.Notification.Timeout) * time.Second,
-			Priority: cfg.Notification.Priority,
-			PoolSize: cfg.Notification.PoolSize,
-		}, l, sched)
+		notifyClient, err := notification.New(ctx, &notification.Config{
+			BaseURL:     cfg.Notification.BaseURL,
+			Timeout:     time.Duration(cfg.Notification.Timeout) * time.Second,
+			Priority:    cfg.Notification.Priority,
+			PoolSize:    cfg.Notification.PoolSize,
+			Token:       cfg.Notification.Token,
+			User:        cfg.Notification.User,
+			Password:    cfg.Notification.Password,
+			MaxFileSize: int64(cfg.Notification.MaxFileSize) << 20,
+			Default:     cfg.Notification.Default,
+			Webhook: structs.Map(cfg.Notification.Webhook, func(w *entity.NotificationWebhook) notification.Webhook {
+				return notification.Webhook{
+					Name:    w.Name,
+					URL:     w.URL,
+					Method:  w.Method,
+					Headers: w.Headers,
+				}
+			}),
+			SMTP: structs.Map(cfg.Notification.SMTP, func(s *entity.NotificationSMTP) notification.SMTP {
+				return notification.SMTP{
+					Name:     s.Name,
+					Host:     s.Host,
+					Port:     s.Port,
+					User:     s.User,
+					Password: s.Password,
+					From:     s.From,
+					To:       s.To,
+					TLS:      s.TLS,
+				}
+			}),
+			Gotify: structs.Map(cfg.Notification.Gotify, func(g *entity.NotificationGotify) notification.Gotify {
+				return notification.Gotify{
+					Name:  g.Name,
+					URL:   g.URL,
+					Token: g.Token,
+				}
+			}),
+			Pushover: structs.Map(cfg.Notification.Pushover, func(p *entity.NotificationPushover) notification.Pushover {
+				return notification.Pushover{
+					Name:   p.Name,
+					URL:    p.URL,
+					Token:  p.Token,
+					User:   p.User,
+					Device: p.Device,
+				}
+			}),
+		}, l, sched, limiter)
 		if err != nil {
 			l.Fatal(err)
 		}
+		notifyHandler = notifyClient
+		notifySubscriber = notifyClient
+	}
+
+	var alertHandler entity.AlertHandler
+	if len(cfg.Alerts.Channels) != 0 {
+		alertUseCase, err := usecase.NewAlertUseCase(ctx, cfg, l, botHandler, notifyHandler)
+		if err != nil {
+			l.Fatal(err)
+		}
+		alertHandler = alertUseCase
+	}
+
+	if taskScheduler != nil {
+		if err := taskScheduler.Start(); err != nil {
+			l.Fatal(err)
+		}
 	}
 
 	sh := script.New(ctx, &script.Config{
@@ -105,12 +240,91 @@ func main() {
 		RegistryMaxSize:     cfg.Scripts.RegistryMaxSize,
 		RegistryGrowStep:    cfg.Scripts.RegistryGrowStep,
 		IncludeGoStackTrace: cfg.Scripts.IncludeGoStackTrace,
+		Templates: structs.Map(cfg.Templates.Items, func(t *entity.Template) script.Template {
+			return script.Template{
+				Name:     t.Name,
+				Title:    t.Title,
+				Body:     t.Body,
+				Topic:    t.Topic,
+				Priority: t.Priority,
+				Tags:     t.Tags,
+				Backends: t.Backends,
+				Telegram: t.Telegram,
+			}
+		}),
+		TemplatesFolder: cfg.Templates.Folder,
 	}, l)
 
-	_, err = usecase.NewScriptUseCase(ctx, cfg, l, mqttClient, sh, tgBot, notifyClient)
+	scriptUseCase, err := usecase.NewScriptUseCase(ctx, cfg, l, mqttClient, sh, sched, botHandler, botSubscriber, notifyHandler, notifySubscriber, alertHandler)
 	if err != nil {
 		l.Fatal(err)
 	}
 
+	if cfg.Bridge.Enabled {
+		br, err := bridge.New(ctx, &bridge.Config{
+			Brokers: structs.Map(cfg.Bridge.Brokers, func(b *entity.BridgeBroker) bridge.Broker {
+				return bridge.Broker{
+					Name: b.Name,
+					Config: mqtt.Config{
+						Host:                 b.Host,
+						Port:                 b.Port,
+						ClientID:             fmt.Sprintf("%s-%s", b.ClientID, b.Name),
+						User:                 b.User,
+						Password:             b.Password,
+						UseTLS:               b.UseTLS,
+						ServerTLS:            b.ServerTLS,
+						CACert:               b.CACert,
+						Cert:                 b.Cert,
+						Key:                  b.Key,
+						ConnectRetryInterval: time.Duration(b.ConnectRetryInterval) * time.Second,
+						Timeout:              time.Duration(b.Timeout) * time.Second,
+					},
+				}
+			}),
+			Rules: structs.Map(cfg.Bridge.Rules, func(r *entity.BridgeRule) bridge.Rule {
+				return bridge.Rule{
+					Name:        r.Name,
+					Source:      r.Source,
+					Destination: r.Destination,
+					Filter:      r.Filter,
+					Topic:       r.Topic,
+					QoS:         byte(r.QoS),
+					Retain:      r.Retain,
+				}
+			}),
+			StatsInterval: time.Duration(cfg.Bridge.StatsInterval) * time.Second,
+			LoopTTL:       time.Duration(cfg.Bridge.LoopTTL) * time.Second,
+		}, l, codec.NewFastJsonCodec())
+		if err != nil {
+			l.Fatal(err)
+		}
+		if err := br.Start(); err != nil {
+			l.Fatal(err)
+		}
+	}
+
+	// only the health checks are served if the API is disabled and API.Health is set
+	if cfg.API.Enabled || cfg.API.Health {
+		apiServer := api.New(ctx, &api.Config{
+			Listen:     cfg.API.Listen,
+			Timeout:    time.Duration(cfg.API.Timeout) * time.Second,
+			Token:      cfg.API.Token,
+			HealthOnly: !cfg.API.Enabled,
+		}, l)
+		apiServer.SetRuntime(scriptUseCase)
+		if cfg.API.Enabled {
+			apiServer.SetScriptHandler(sh)
+			if taskScheduler != nil {
+				apiServer.SetScheduler(taskScheduler)
+			}
+			if alertHandler != nil {
+				apiServer.SetAlertHandler(alertHandler)
+			}
+		}
+		if err := apiServer.Start(); err != nil {
+			l.Fatal(err)
+		}
+	}
+
 	entity.GetWg(ctx).Wait()
 }
@@ -11,7 +11,7 @@ function Init()
         Description = "An example of the script",
         Subscribe = {
             "zigbee2mqtt/temperature_1",
-            "zigbee2mqtt/socket_1"
+            { Topic = "zigbee2mqtt/socket_1", Retained = false }
         }
     }
 end
@@ -26,7 +26,7 @@ function Main()
     print("check global variable: ", hb.getGlobal("GlobalVar"))
 end
 
-function OnMessage(topic, data)
+function OnMessage(topic, data, meta)
     if topic == "zigbee2mqtt/socket_1" then
         socket_on = data.state == "ON"
     elseif topic == "zigbee2mqtt/temperature_1" then
@@ -55,5 +55,5 @@ end
 function OnAlarm(name, data)
     print("alarm called: ", name)
     --hb.sendMessage("Test message in Telegram")
-    --hb.pushNotify("my-super-secret-topic-name", "Message title", "Message text", "high")
+    --hb.pushNotify({ topic = "my-super-secret-topic-name", title = "Message title", body = "Message text", priority = "high", tags = { "bell" } })
 end
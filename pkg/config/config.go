@@ -174,11 +174,16 @@ func isSet(structField reflect.StructField, field *reflect.Value) bool {
 		return true
 	}
 	if structField.Type.Kind() == reflect.Slice {
-		return true
+		return !isStructSlice(structField.Type) && field.Len() != 0
 	}
 	return false
 }
 
+// isStructSlice returns true for slices of pointers to structs, their elements are parsed to apply defaults
+func isStructSlice(t reflect.Type) bool {
+	return t.Elem().Kind() == reflect.Ptr && t.Elem().Elem().Kind() == reflect.Struct
+}
+
 func setValue(structField reflect.StructField, field *reflect.Value, value string) error {
 	switch structField.Type.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
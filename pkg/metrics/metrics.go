@@ -0,0 +1,138 @@
+// Package metrics contains Prometheus metrics of the application
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace     = "honeybee"
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+	gauges   = make(map[string]*gaugeFunc)
+	gaugesMu sync.Mutex
+)
+
+var (
+	MQTTReceived = counterVec("mqtt_messages_received_total",
+		"MQTT messages received by the subscriptions of scripts per the first topic level", "prefix")
+	MQTTPublished = counterVec("mqtt_messages_published_total",
+		"MQTT messages published by the application per the first topic level", "prefix")
+	ScriptDispatch = histogramVec("script_dispatch_duration_seconds",
+		"Time from queuing the script event to the end of its handler", "script")
+	ScriptErrors = counterVec("script_errors_total",
+		"Errors returned by the script event handlers", "script", "callback")
+	ScriptReloads = counterVec("script_reloads_total",
+		"Script loads and reloads", "script", "result")
+	SchedulerRetries = counterVec("scheduler_retries_total",
+		"Failed scheduler task runs which are retried later", "sender")
+	SchedulerDeadLetters = counterVec("scheduler_dead_letters_total",
+		"Scheduler tasks which exhausted their attempts", "sender")
+	NotificationDeliveries = counterVec("notification_deliveries_total",
+		"Notification deliveries per backend", "backend", "result")
+	TelegramDeliveries = counterVec("telegram_deliveries_total",
+		"Telegram messages sent to chats", "result")
+	BridgeReceived = counterVec("bridge_messages_received_total",
+		"Messages received by the MQTT bridge rules", "rule")
+	BridgeMessages = counterVec("bridge_messages_total",
+		"Messages of the MQTT bridge rules per result: forwarded, dropped or failed", "rule", "result")
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Result returns the result label value of the operation
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// TopicPrefix returns the first level of the topic, it keeps the number of label values small
+func TopicPrefix(topic string) string {
+	prefix, _, _ := strings.Cut(topic, "/")
+	return prefix
+}
+
+// RegisterGaugeFunc registers the gauge which values are returned by f per label value when metrics are collected,
+// the gauge is registered once and registering it again replaces f
+func RegisterGaugeFunc(name, help, label string, f func() map[string]float64) {
+	gaugesMu.Lock()
+	defer gaugesMu.Unlock()
+
+	if g, ok := gauges[name]; ok {
+		g.set(f)
+		return
+	}
+
+	g := &gaugeFunc{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, []string{label}, nil),
+		f:    f,
+	}
+	registry.MustRegister(g)
+	gauges[name] = g
+}
+
+type gaugeFunc struct {
+	desc *prometheus.Desc
+	f    func() map[string]float64
+	mu   sync.Mutex
+}
+
+func (g *gaugeFunc) set(f func() map[string]float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.f = f
+}
+
+func (g *gaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *gaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	f := g.f
+	g.mu.Unlock()
+
+	for label, v := range f() {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, v, label)
+	}
+}
+
+func counterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, labels)
+	registry.MustRegister(c)
+	return c
+}
+
+func histogramVec(name, help string, labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30},
+	}, labels)
+	registry.MustRegister(h)
+	return h
+}
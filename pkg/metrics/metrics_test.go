@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterGaugeFuncTwice(t *testing.T) {
+	RegisterGaugeFunc("test_gauge", "Test gauge", "label", func() map[string]float64 {
+		return map[string]float64{"first": 1}
+	})
+	RegisterGaugeFunc("test_gauge", "Test gauge", "label", func() map[string]float64 {
+		return map[string]float64{"second": 2}
+	})
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+	if !strings.Contains(body, `honeybee_test_gauge{label="second"} 2`) {
+		t.Fatalf("the gauge function is not replaced:\n%s", body)
+	}
+	if strings.Contains(body, `label="first"`) {
+		t.Fatalf("the previous gauge function is collected:\n%s", body)
+	}
+}
@@ -0,0 +1,127 @@
+// Package ratelimit limits the rate of messages per channel and suppresses duplicates
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	pruneEvery = 1000
+)
+
+type Config struct {
+	Rate     float64       // messages per minute per channel, 0 - unlimited
+	Burst    int           // number of messages which can be sent at once
+	Interval time.Duration // minimum interval between messages with the same key, 0 - no deduplication
+}
+
+// Limiter combines the token bucket per channel with "at most one per interval" per key
+type Limiter struct {
+	cfg     Config
+	buckets map[string]*bucket
+	keys    map[string]*key
+	calls   int
+	sync.Mutex
+}
+
+type bucket struct {
+	tokens     float64
+	updatedAt  time.Time
+	suppressed int
+}
+
+type key struct {
+	sentAt     time.Time
+	interval   time.Duration
+	suppressed int
+}
+
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+		keys:    make(map[string]*key),
+	}
+}
+
+// Allow reports whether the message of the channel with the key may be sent, the empty key disables deduplication
+// and interval overrides the configured one. The number of messages suppressed since the previous allowed message
+// of the key (or of the channel for messages without a key) is returned with the allowed message.
+func (l *Limiter) Allow(channel, k string, interval time.Duration) (bool, int) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	if interval == 0 {
+		interval = l.cfg.Interval
+	}
+
+	var ks *key
+	if len(k) != 0 {
+		id := channel + "\x00" + k
+		if ks = l.keys[id]; ks == nil {
+			ks = &key{}
+			l.keys[id] = ks
+		}
+		ks.interval = interval
+		if !ks.sentAt.IsZero() && now.Sub(ks.sentAt) < interval {
+			ks.suppressed++
+			return false, 0
+		}
+	}
+
+	b := l.bucket(channel, now)
+	if l.cfg.Rate > 0 && b.tokens < 1 {
+		if ks != nil {
+			ks.suppressed++
+		} else {
+			b.suppressed++
+		}
+		return false, 0
+	}
+	b.tokens--
+
+	var suppressed int
+	if ks != nil {
+		ks.sentAt = now
+		suppressed, ks.suppressed = ks.suppressed, 0
+	} else {
+		suppressed, b.suppressed = b.suppressed, 0
+	}
+
+	return true, suppressed
+}
+
+// bucket returns the token bucket of the channel refilled up to now
+func (l *Limiter) bucket(channel string, now time.Time) *bucket {
+	burst := float64(max(l.cfg.Burst, 1))
+
+	b, ok := l.buckets[channel]
+	if !ok {
+		b = &bucket{tokens: burst, updatedAt: now}
+		l.buckets[channel] = b
+		return b
+	}
+
+	b.tokens = min(burst, b.tokens+now.Sub(b.updatedAt).Minutes()*l.cfg.Rate)
+	b.updatedAt = now
+
+	return b
+}
+
+// prune removes expired keys without suppressed messages
+func (l *Limiter) prune(now time.Time) {
+	if l.calls++; l.calls < pruneEvery {
+		return
+	}
+	l.calls = 0
+
+	for id, ks := range l.keys {
+		if ks.suppressed == 0 && now.Sub(ks.sentAt) >= ks.interval {
+			delete(l.keys, id)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type allowResult struct {
+	ok         bool
+	suppressed int
+}
+
+func allow(l *Limiter, channel, k string, interval time.Duration) allowResult {
+	ok, suppressed := l.Allow(channel, k, interval)
+	return allowResult{ok, suppressed}
+}
+
+// rewind moves the state of the limiter back in time as if d passed
+func rewind(l *Limiter, d time.Duration) {
+	for _, b := range l.buckets {
+		b.updatedAt = b.updatedAt.Add(-d)
+	}
+	for _, ks := range l.keys {
+		ks.sentAt = ks.sentAt.Add(-d)
+	}
+}
+
+func TestAllowTokenBucket(t *testing.T) {
+	l := New(Config{Rate: 60, Burst: 2})
+
+	want := []allowResult{{true, 0}, {true, 0}, {false, 0}, {false, 0}}
+	for i, w := range want {
+		if got := allow(l, "bot", "", 0); got != w {
+			t.Fatalf("message %d: got %+v, want %+v", i, got, w)
+		}
+	}
+
+	// other channels have their own buckets
+	if got := allow(l, "ntfy", "", 0); !got.ok {
+		t.Fatal("expected the message of the other channel to be allowed")
+	}
+
+	// one token per second is added, the suppressed messages are reported once
+	rewind(l, time.Second)
+	if got := allow(l, "bot", "", 0); got != (allowResult{true, 2}) {
+		t.Fatalf("expected the message to be allowed with 2 suppressed, got %+v", got)
+	}
+	if got := allow(l, "bot", "", 0); got.ok {
+		t.Fatal("expected the bucket to be empty")
+	}
+
+	// the bucket is refilled up to the burst
+	rewind(l, time.Hour)
+	for i := range 2 {
+		if got := allow(l, "bot", "", 0); !got.ok {
+			t.Fatalf("message %d: expected to be allowed", i)
+		}
+	}
+	if got := allow(l, "bot", "", 0); got.ok {
+		t.Fatal("expected the bucket to be limited by the burst")
+	}
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	l := New(Config{})
+
+	for i := range 100 {
+		if got := allow(l, "bot", "", 0); got != (allowResult{true, 0}) {
+			t.Fatalf("message %d: got %+v", i, got)
+		}
+	}
+}
+
+func TestAllowDedupe(t *testing.T) {
+	l := New(Config{Interval: time.Minute})
+
+	want := []allowResult{{true, 0}, {false, 0}, {false, 0}}
+	for i, w := range want {
+		if got := allow(l, "bot", "leak", 0); got != w {
+			t.Fatalf("message %d: got %+v, want %+v", i, got, w)
+		}
+	}
+
+	// keys are deduplicated per key and channel, messages without a key are not deduplicated
+	for _, tt := range []struct{ channel, key string }{{"bot", "fire"}, {"ntfy", "leak"}, {"bot", ""}, {"bot", ""}} {
+		if got := allow(l, tt.channel, tt.key, 0); !got.ok {
+			t.Fatalf("expected the message %s/%s to be allowed", tt.channel, tt.key)
+		}
+	}
+
+	rewind(l, time.Minute)
+	if got := allow(l, "bot", "leak", 0); got != (allowResult{true, 2}) {
+		t.Fatalf("expected the message to be allowed with 2 suppressed, got %+v", got)
+	}
+}
+
+func TestAllowIntervalOverride(t *testing.T) {
+	l := New(Config{Interval: time.Hour})
+
+	allow(l, "bot", "leak", time.Minute)
+	rewind(l, time.Minute)
+	if got := allow(l, "bot", "leak", time.Minute); got != (allowResult{true, 0}) {
+		t.Fatalf("expected the interval of the message to be used, got %+v", got)
+	}
+
+	// no interval means no deduplication
+	l = New(Config{})
+	for i := range 3 {
+		if got := allow(l, "bot", "leak", 0); !got.ok {
+			t.Fatalf("message %d: expected to be allowed", i)
+		}
+	}
+}
+
+func TestAllowSuppressedByRate(t *testing.T) {
+	l := New(Config{Rate: 60, Burst: 1, Interval: time.Minute})
+
+	allow(l, "bot", "leak", 0)
+	// messages suppressed by the rate are counted by their keys or by the channel
+	allow(l, "bot", "fire", 0)
+	allow(l, "bot", "fire", 0)
+	allow(l, "bot", "", 0)
+
+	rewind(l, time.Second)
+	if got := allow(l, "bot", "fire", 0); got != (allowResult{true, 2}) {
+		t.Fatalf("expected the key to report 2 suppressed, got %+v", got)
+	}
+
+	rewind(l, time.Second)
+	if got := allow(l, "bot", "", 0); got != (allowResult{true, 1}) {
+		t.Fatalf("expected the channel to report 1 suppressed, got %+v", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l := New(Config{Interval: time.Minute})
+
+	allow(l, "bot", "expired", 0)
+	allow(l, "bot", "suppressed", 0)
+	allow(l, "bot", "suppressed", 0)
+	rewind(l, time.Minute)
+	allow(l, "bot", "recent", 0)
+
+	for range pruneEvery {
+		allow(l, "bot", "", 0)
+	}
+
+	if _, ok := l.keys["bot\x00expired"]; ok {
+		t.Error("expected the expired key to be removed")
+	}
+	if _, ok := l.keys["bot\x00suppressed"]; !ok {
+		t.Error("expected the key with suppressed messages to be kept")
+	}
+	if _, ok := l.keys["bot\x00recent"]; !ok {
+		t.Error("expected the recent key to be kept")
+	}
+}
@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter defines how the random part of the delay is calculated
+type Jitter string
+
+const (
+	// JitterNone uses the exact exponential delay
+	JitterNone Jitter = "none"
+	// JitterFull uses a random delay between zero and the exponential delay
+	JitterFull Jitter = "full"
+	// JitterEqual uses a half of the exponential delay plus a random delay up to another half
+	JitterEqual Jitter = "equal"
+)
+
+// Backoff defines delays between attempts: min(MaxDelay, Delay * Multiplier ^ attempt) with optional jitter
+type Backoff struct {
+	Delay      time.Duration `json:"delay"`
+	Multiplier float64       `json:"multiplier"`
+	MaxDelay   time.Duration `json:"max_delay"`
+	Jitter     Jitter        `json:"jitter"`
+}
+
+// Duration returns the delay before the attempt, attempts are numbered from zero
+func (b *Backoff) Duration(attempt int) time.Duration {
+	d := float64(b.Delay) * math.Pow(b.Multiplier, float64(attempt))
+	if d > float64(b.MaxDelay) || math.IsInf(d, 0) || math.IsNaN(d) {
+		d = float64(b.MaxDelay)
+	}
+
+	switch b.Jitter {
+	case JitterFull:
+		d = rand.Float64() * d
+	case JitterEqual:
+		d = d/2 + rand.Float64()*d/2
+	}
+
+	return time.Duration(d)
+}
+
+func (b *Backoff) normalize(def *Backoff) {
+	if b.Delay == 0 {
+		b.Delay = def.Delay
+	}
+	if b.Multiplier == 0 {
+		b.Multiplier = def.Multiplier
+	}
+	if b.MaxDelay == 0 {
+		b.MaxDelay = def.MaxDelay
+	}
+	if len(b.Jitter) == 0 {
+		b.Jitter = def.Jitter
+	}
+	if b.MaxDelay < b.Delay {
+		b.MaxDelay = b.Delay
+	}
+}
@@ -4,13 +4,30 @@ import (
 	"time"
 )
 
+const (
+	defaultDeadLetterSize = 100
+)
+
 type Config struct {
 	MaxTasksPerSender int
-	MaxTaskDelay      time.Duration
+	MaxAttempts       int
+	MaxProcessingTime time.Duration
+	Backoff           Backoff
+	DeadLetterSize    int
+	Store             Store
 }
 
 func (c *Config) normalize() {
-	if c.MaxTaskDelay == 0 {
-		c.MaxTaskDelay = defaultTaskMaxDelay
+	c.Backoff.normalize(&Backoff{
+		Delay:      defaultTaskDelay,
+		Multiplier: defaultMultiplier,
+		MaxDelay:   defaultTaskMaxDelay,
+		Jitter:     defaultJitter,
+	})
+	if c.MaxProcessingTime == 0 {
+		c.MaxProcessingTime = defaultTaskMaxProcessingTime
+	}
+	if c.DeadLetterSize == 0 {
+		c.DeadLetterSize = defaultDeadLetterSize
 	}
 }
@@ -0,0 +1,34 @@
+package scheduler
+
+import (
+	"time"
+)
+
+// DeadLetter is a task which has exhausted its attempts or processing time
+type DeadLetter struct {
+	Sender    string    `json:"sender"`
+	Kind      string    `json:"kind"`
+	Payload   []byte    `json:"payload"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// DeadLetterHandler is called for every task moved to the dead-letter list
+type DeadLetterHandler func(dl *DeadLetter)
+
+func newDeadLetter(t *Task) *DeadLetter {
+	dl := &DeadLetter{
+		Sender:    t.Sender,
+		Kind:      t.Kind,
+		Payload:   t.Payload,
+		Attempts:  t.attempt,
+		CreatedAt: t.createdAt,
+		FailedAt:  time.Now(),
+	}
+	if t.lastErr != nil {
+		dl.Error = t.lastErr.Error()
+	}
+	return dl
+}
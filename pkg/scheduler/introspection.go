@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"time"
+)
+
+// TaskInfo describes the pending task
+type TaskInfo struct {
+	ID        int64     `json:"id"`
+	Sender    string    `json:"sender"`
+	Kind      string    `json:"kind"`
+	Attempt   int       `json:"attempt"`
+	CreatedAt time.Time `json:"created_at"`
+	NextRunAt time.Time `json:"next_run_at"`
+	Age       string    `json:"age"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Tasks returns pending tasks grouped by sender
+func (s *Scheduler) Tasks() map[string][]*TaskInfo {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	tasks := make(map[string][]*TaskInfo, len(s.tasks))
+	for sender := range s.tasks {
+		if len(s.tasks[sender]) == 0 {
+			continue
+		}
+		tasks[sender] = make([]*TaskInfo, 0, len(s.tasks[sender]))
+		for _, t := range s.tasks[sender] {
+			ti := &TaskInfo{
+				ID:        t.id,
+				Sender:    t.Sender,
+				Kind:      t.Kind,
+				Attempt:   t.attempt,
+				CreatedAt: t.createdAt,
+				NextRunAt: t.nextRunAt,
+				Age:       now.Sub(t.createdAt).Round(time.Second).String(),
+			}
+			if t.lastErr != nil {
+				ti.LastError = t.lastErr.Error()
+			}
+			tasks[sender] = append(tasks[sender], ti)
+		}
+	}
+
+	return tasks
+}
+
+// Cancel removes the pending task
+func (s *Scheduler) Cancel(id int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	t := s.findTask(id)
+	if t == nil {
+		return false
+	}
+
+	t.Stop()
+	s.deleteTask(t)
+
+	return true
+}
+
+// CancelSender removes all pending tasks of the sender and returns their number
+func (s *Scheduler) CancelSender(sender string) int {
+	s.Lock()
+	defer s.Unlock()
+
+	tasks := s.tasks[sender]
+	for _, t := range tasks {
+		t.Stop()
+		s.deleteStored(t)
+	}
+	delete(s.tasks, sender)
+
+	return len(tasks)
+}
+
+// Flush runs the pending task now, false is returned if the task is not found or is already running
+func (s *Scheduler) Flush(id int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	t := s.findTask(id)
+	if t == nil {
+		return false
+	}
+
+	return s.flush(t)
+}
+
+// FlushSender runs all pending tasks of the sender now, all tasks are run if the sender is empty.
+// The number of rescheduled tasks is returned, tasks which are already running are not counted.
+func (s *Scheduler) FlushSender(sender string) int {
+	s.Lock()
+	defer s.Unlock()
+
+	var count int
+	for _, tasks := range s.tasks {
+		for _, t := range tasks {
+			if len(sender) != 0 && t.Sender != sender {
+				continue
+			}
+			if s.flush(t) {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// flush reschedules the task to run now, false is returned if the task is already running
+func (s *Scheduler) flush(t *Task) bool {
+	if t.timer != nil && !t.timer.Stop() {
+		return false
+	}
+	t.nextRunAt = time.Now()
+	s.schedule(t, 0)
+	return true
+}
+
+func (s *Scheduler) findTask(id int64) *Task {
+	for _, tasks := range s.tasks {
+		for _, t := range tasks {
+			if t.id == id {
+				return t
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/forest33/honeybee/pkg/logger"
+)
+
+func TestFlushSender(t *testing.T) {
+	s := New(&Config{}, logger.NewDefault())
+
+	started, release, flushed := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	s.RegisterHandler("test", func(payload []byte) error {
+		switch string(payload) {
+		case "running":
+			close(started)
+			<-release
+		case "pending":
+			close(flushed)
+		}
+		return nil
+	})
+	defer close(release)
+
+	s.AddTask(&Task{Sender: "test", Kind: "test", Payload: []byte("running"), Immediate: true})
+	<-started
+	s.AddTask(&Task{Sender: "test", Kind: "test", Payload: []byte("pending"), Backoff: Backoff{Delay: time.Hour}})
+
+	if s.Flush(1) {
+		t.Error("expected the running task not to be flushed")
+	}
+	if n := s.FlushSender("test"); n != 1 {
+		t.Errorf("expected 1 flushed task, got %d", n)
+	}
+	if n := s.FlushSender("other"); n != 0 {
+		t.Errorf("expected no flushed tasks of other sender, got %d", n)
+	}
+
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the flushed task is not run")
+	}
+}
@@ -8,34 +8,122 @@ import (
 	"time"
 
 	"github.com/forest33/honeybee/pkg/logger"
+	"github.com/forest33/honeybee/pkg/metrics"
+	"github.com/forest33/honeybee/pkg/structs"
 )
 
 type Scheduler struct {
-	cfg    *Config
-	log    *logger.Logger
-	tasks  map[string][]*Task
-	taskID atomic.Int64
+	cfg               *Config
+	log               *logger.Logger
+	tasks             map[string][]*Task
+	handlers          map[string]TaskHandler
+	deadLetters       []*DeadLetter
+	deadLetterHandler DeadLetterHandler
+	taskID            atomic.Int64
 	sync.Mutex
 }
 
 func New(cfg *Config, log *logger.Logger) *Scheduler {
 	cfg.normalize()
 
-	return &Scheduler{
-		cfg:   cfg,
-		log:   log,
-		tasks: make(map[string][]*Task),
+	s := &Scheduler{
+		cfg:         cfg,
+		log:         log,
+		tasks:       make(map[string][]*Task),
+		handlers:    make(map[string]TaskHandler),
+		deadLetters: make([]*DeadLetter, 0, cfg.DeadLetterSize),
 	}
+
+	metrics.RegisterGaugeFunc("scheduler_tasks", "Pending scheduler tasks", "sender", s.queueDepth)
+
+	return s
+}
+
+// queueDepth returns the number of pending tasks per sender
+func (s *Scheduler) queueDepth() map[string]float64 {
+	s.Lock()
+	defer s.Unlock()
+
+	depth := make(map[string]float64, len(s.tasks))
+	for sender, tasks := range s.tasks {
+		depth[sender] = float64(len(tasks))
+	}
+	return depth
+}
+
+// SetDeadLetterHandler sets the handler called for exhausted tasks
+func (s *Scheduler) SetDeadLetterHandler(h DeadLetterHandler) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.deadLetterHandler = h
+}
+
+// DeadLetters returns the most recent exhausted tasks
+func (s *Scheduler) DeadLetters() []*DeadLetter {
+	s.Lock()
+	defer s.Unlock()
+
+	return slices.Clone(s.deadLetters)
+}
+
+// RegisterHandler sets the handler for tasks of the kind
+func (s *Scheduler) RegisterHandler(kind string, h TaskHandler) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.handlers[kind] = h
+}
+
+// Start loads pending tasks from the store and resumes their backoff,
+// handlers of all task kinds must be registered before
+func (s *Scheduler) Start() error {
+	if s.cfg.Store == nil {
+		return nil
+	}
+
+	tasks, err := s.cfg.Store.Load()
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(tasks, func(a, b *Task) int {
+		return cmp.Compare(a.id, b.id)
+	})
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, t := range tasks {
+		if _, ok := s.handlers[t.Kind]; !ok {
+			s.log.Error().Str("sender", t.Sender).Str("kind", t.Kind).Msg("unknown task kind, task removed")
+			s.deleteStored(t)
+			continue
+		}
+
+		if t.id > s.taskID.Load() {
+			s.taskID.Store(t.id)
+		}
+
+		t.normalize(s.cfg)
+		s.tasks[t.Sender] = append(s.tasks[t.Sender], t)
+		s.schedule(t, time.Until(t.nextRunAt))
+	}
+
+	s.log.Info().Int("tasks", len(tasks)).Msg("scheduler tasks loaded")
+
+	return nil
 }
 
 func (s *Scheduler) AddTask(t *Task) {
 	s.Lock()
 	defer s.Unlock()
 
-	t.Normalize()
+	t.normalize(s.cfg)
 
 	if s.cfg.MaxTasksPerSender > 0 && len(s.tasks[t.Sender]) >= s.cfg.MaxTasksPerSender {
 		s.tasks[t.Sender][0].Stop()
+		s.deleteStored(s.tasks[t.Sender][0])
 		s.tasks[t.Sender] = slices.Delete(s.tasks[t.Sender], 0, 1)
 	}
 
@@ -45,42 +133,80 @@ func (s *Scheduler) AddTask(t *Task) {
 
 	s.tasks[t.Sender] = append(s.tasks[t.Sender], t)
 
+	d := structs.If(t.Immediate, 0, t.Backoff.Duration(0))
+
 	t.id = s.taskID.Add(1)
 	t.createdAt = time.Now()
-	t.maxDelay = s.cfg.MaxTaskDelay
-	t.timer = time.AfterFunc(t.Delay, func() {
+	t.nextRunAt = t.createdAt.Add(d)
+
+	s.save(t)
+	s.schedule(t, d)
+}
+
+func (s *Scheduler) schedule(t *Task, d time.Duration) {
+	t.timer = time.AfterFunc(max(d, 0), func() {
 		s.task(t)
 	})
 }
 
 func (s *Scheduler) task(t *Task) {
 	s.Lock()
+
+	if t.removed {
+		s.Unlock()
+		return
+	}
+
+	s.log.Debug().Str("sender", t.Sender).Str("kind", t.Kind).Int("attempt", t.attempt).Msg("run scheduler task")
+
+	h, ok := s.handlers[t.Kind]
+	if !ok {
+		s.log.Error().Str("sender", t.Sender).Str("kind", t.Kind).Msg("task handler not found")
+		s.deleteTask(t)
+		s.Unlock()
+		return
+	}
+
+	// the handler may add new tasks
+	s.Unlock()
+	err := h(t.Payload)
+	s.Lock()
 	defer s.Unlock()
 
-	s.log.Debug().Str("sender", t.Sender).Float64("attempt", t.attempt).Msg("run scheduler task")
+	if t.removed {
+		return
+	}
 
-	if err := t.Handler(); err == nil {
-		s.log.Debug().Str("sender", t.Sender).Float64("attempt", t.attempt).Msg("task completed")
+	if t.lastErr = err; t.lastErr == nil {
+		s.log.Debug().Str("sender", t.Sender).Int("attempt", t.attempt).Msg("task completed")
 		s.deleteTask(t)
 		return
 	}
 
 	d, ok := t.GetDelay()
 	if !ok {
-		s.log.Debug().
+		s.log.Warn().
+			Err(t.lastErr).
 			Str("sender", t.Sender).
-			Float64("attempt", t.attempt).
+			Str("kind", t.Kind).
+			Int("attempt", t.attempt).
 			Dur("processing_time", time.Since(t.createdAt)).
-			Msg("maximum number of attempts or processing time exceeded")
+			Msg("maximum number of attempts or processing time exceeded, task moved to dead letters")
+		s.deleteTask(t)
+		s.addDeadLetter(t)
 		return
 	}
 
-	t.timer = time.AfterFunc(d, func() {
-		s.task(t)
-	})
+	metrics.SchedulerRetries.WithLabelValues(t.Sender).Inc()
+
+	t.nextRunAt = time.Now().Add(d)
+	s.save(t)
+	s.schedule(t, d)
 }
 
 func (s *Scheduler) deleteTask(t *Task) {
+	s.deleteStored(t)
+
 	idx, ok := slices.BinarySearchFunc(s.tasks[t.Sender], t, func(a, b *Task) int {
 		return cmp.Compare(a.id, b.id)
 	})
@@ -89,3 +215,35 @@ func (s *Scheduler) deleteTask(t *Task) {
 	}
 	s.tasks[t.Sender] = slices.Delete(s.tasks[t.Sender], idx, idx+1)
 }
+
+func (s *Scheduler) addDeadLetter(t *Task) {
+	dl := newDeadLetter(t)
+	metrics.SchedulerDeadLetters.WithLabelValues(t.Sender).Inc()
+
+	if len(s.deadLetters) >= s.cfg.DeadLetterSize {
+		s.deadLetters = slices.Delete(s.deadLetters, 0, 1)
+	}
+	s.deadLetters = append(s.deadLetters, dl)
+
+	if s.deadLetterHandler != nil {
+		go s.deadLetterHandler(dl)
+	}
+}
+
+func (s *Scheduler) save(t *Task) {
+	if s.cfg.Store == nil || t.Volatile {
+		return
+	}
+	if err := s.cfg.Store.Save(t); err != nil {
+		s.log.Error().Err(err).Str("sender", t.Sender).Str("kind", t.Kind).Msg("failed to save task")
+	}
+}
+
+func (s *Scheduler) deleteStored(t *Task) {
+	if s.cfg.Store == nil || t.Volatile {
+		return
+	}
+	if err := s.cfg.Store.Delete(t); err != nil {
+		s.log.Error().Err(err).Str("sender", t.Sender).Str("kind", t.Kind).Msg("failed to delete stored task")
+	}
+}
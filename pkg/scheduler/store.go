@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	storeFileExt = ".json"
+)
+
+// Store is a durable storage of pending tasks
+type Store interface {
+	Save(t *Task) error
+	Delete(t *Task) error
+	Load() ([]*Task, error)
+}
+
+// FileStore keeps every pending task in a separate JSON file of the folder
+type FileStore struct {
+	path string
+}
+
+type taskRecord struct {
+	ID                int64         `json:"id"`
+	Sender            string        `json:"sender"`
+	Kind              string        `json:"kind"`
+	Payload           []byte        `json:"payload"`
+	Backoff           Backoff       `json:"backoff"`
+	MaxAttempts       int           `json:"max_attempts"`
+	MaxProcessingTime time.Duration `json:"max_processing_time"`
+	CreatedAt         time.Time     `json:"created_at"`
+	NextRunAt         time.Time     `json:"next_run_at"`
+	Attempt           int           `json:"attempt"`
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create scheduler store folder: %w", err)
+	}
+	return &FileStore{path: path}, nil
+}
+
+func (s *FileStore) Save(t *Task) error {
+	data, err := json.Marshal(&taskRecord{
+		ID:                t.id,
+		Sender:            t.Sender,
+		Kind:              t.Kind,
+		Payload:           t.Payload,
+		Backoff:           t.Backoff,
+		MaxAttempts:       t.MaxAttempts,
+		MaxProcessingTime: t.MaxProcessingTime,
+		CreatedAt:         t.createdAt,
+		NextRunAt:         t.nextRunAt,
+		Attempt:           t.attempt,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp := s.fileName(t.id) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.fileName(t.id))
+}
+
+func (s *FileStore) Delete(t *Task) error {
+	if err := os.Remove(s.fileName(t.id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Load() ([]*Task, error) {
+	files, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*Task, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != storeFileExt {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.path, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		r := &taskRecord{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return nil, fmt.Errorf("failed to decode task %s: %w", f.Name(), err)
+		}
+
+		tasks = append(tasks, &Task{
+			Sender:            r.Sender,
+			Kind:              r.Kind,
+			Payload:           r.Payload,
+			Backoff:           r.Backoff,
+			MaxAttempts:       r.MaxAttempts,
+			MaxProcessingTime: r.MaxProcessingTime,
+			id:                r.ID,
+			createdAt:         r.CreatedAt,
+			nextRunAt:         r.NextRunAt,
+			attempt:           r.Attempt,
+		})
+	}
+
+	return tasks, nil
+}
+
+func (s *FileStore) fileName(id int64) string {
+	return filepath.Join(s.path, strconv.FormatInt(id, 10)+storeFileExt)
+}
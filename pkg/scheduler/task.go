@@ -1,7 +1,6 @@
 package scheduler
 
 import (
-	"math"
 	"time"
 )
 
@@ -9,56 +8,58 @@ const (
 	defaultTaskDelay             = time.Second
 	defaultTaskMaxDelay          = time.Hour
 	defaultTaskMaxProcessingTime = time.Hour * 24 * 7
-	defaultExpFactor             = 1
+	defaultMultiplier            = 2
+	defaultJitter                = JitterEqual
 )
 
-type TaskHandler func() error
+// TaskHandler executes the task of a specific kind
+type TaskHandler func(payload []byte) error
 
+// Task is described by the kind and payload, the kind defines the handler which processes the payload
 type Task struct {
 	Sender            string
-	Delay             time.Duration
+	Kind              string
+	Payload           []byte
+	Backoff           Backoff
 	MaxAttempts       int
 	MaxProcessingTime time.Duration
-	ExpFactor         float64
-	Handler           TaskHandler
+	Immediate         bool // the first attempt is run without delay
+	Volatile          bool // the task is not saved to the store
 	id                int64
 	createdAt         time.Time
-	maxDelay          time.Duration
+	nextRunAt         time.Time
 	timer             *time.Timer
-	attempt           float64
+	attempt           int
+	lastErr           error
+	removed           bool
 }
 
-func (t *Task) Normalize() {
-	if t.Delay == 0 {
-		t.Delay = defaultTaskDelay
-	}
-	if t.ExpFactor == 0 {
-		t.ExpFactor = defaultExpFactor
+func (t *Task) normalize(cfg *Config) {
+	t.Backoff.normalize(&cfg.Backoff)
+	if t.MaxAttempts == 0 {
+		t.MaxAttempts = cfg.MaxAttempts
 	}
 	if t.MaxProcessingTime == 0 {
-		t.MaxProcessingTime = defaultTaskMaxProcessingTime
+		t.MaxProcessingTime = cfg.MaxProcessingTime
 	}
 }
 
+// GetDelay returns the delay before the next attempt, false is returned if the task is exhausted
 func (t *Task) GetDelay() (time.Duration, bool) {
 	t.attempt++
 
-	if t.MaxAttempts > 0 && t.attempt >= float64(t.MaxAttempts) {
+	if t.MaxAttempts > 0 && t.attempt >= t.MaxAttempts {
 		return time.Duration(0), false
 	}
 	if t.MaxProcessingTime > 0 && time.Since(t.createdAt) > t.MaxProcessingTime {
 		return time.Duration(0), false
 	}
 
-	delay := time.Duration(math.Exp(t.ExpFactor*t.attempt)) * time.Second
-	if delay > t.maxDelay {
-		delay = t.Delay
-	}
-
-	return delay, true
+	return t.Backoff.Duration(t.attempt), true
 }
 
 func (t *Task) Stop() {
+	t.removed = true
 	if t.timer == nil {
 		return
 	}